@@ -1,6 +1,8 @@
 package src
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
@@ -8,15 +10,34 @@ var (
 	cfgFile     string
 	concurrency int
 	dryRun      bool
+	keepGoing   bool
+	force       bool
+	gracePeriod time.Duration
+	runTimeout  time.Duration
 	verbose     bool
 	varsSlice   []string
 	version     = "0.1.0"
 	noMaster    bool
+	outputMode  string
+	runFormat   string
+	timings     bool
+	traceFile   string
+	watchMode   bool
+	debounce    time.Duration
 	modeFlag    bool
+
+	validateFormat string
+	graphFormat    string
+	graphWaves     bool
+	listTree       bool
+	listJSON       bool
+	listTags       []string
+	showResolved   bool
+	showJSON       bool
 )
 
 func cmdRoot() *cobra.Command {
-	return &cobra.Command{Use: "wrkit [flags] [task-name]",
+	return &cobra.Command{Use: "wrkit [flags] [task-name [args...]]... [-- cli-args...]",
 		Short: "wrkit — YAML-powered tiny make-like runner",
 		Long:  cmdRootLongDescription,
 		RunE:  cmdRootLogic,
@@ -25,33 +46,92 @@ func cmdRoot() *cobra.Command {
 
 func cmdRun() *cobra.Command {
 	return &cobra.Command{
-		Use:   "run [task]",
-		Short: "Run task and its dependencies",
-		Args:  cobra.ExactArgs(1),
+		Use:   "run [task [args...]]... [-- cli-args...]",
+		Short: "Run tasks and their dependencies",
+		Args:  cobra.MinimumNArgs(1),
 		RunE:  cmdRunLogic,
 		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-			if len(args) == 0 {
-				return getTaskNameCompletions(toComplete)
-			}
-			return nil, cobra.ShellCompDirectiveNoFileComp
+			return getTaskNameCompletions(toComplete)
 		},
 	}
 }
 
-func cmdList() *cobra.Command {
+func cmdWatch() *cobra.Command {
 	return &cobra.Command{
-		Use:   "list",
-		Short: "List tasks in the config",
+		Use:   "watch [task [args...]]... [-- cli-args...]",
+		Short: "Run tasks and run them again whenever their sources or watch files change",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  cmdWatchLogic,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return getTaskNameCompletions(toComplete)
+		},
+	}
+}
+
+func cmdList() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [pattern...]",
+		Short: "List tasks in the config, optionally only those matching name globs",
 		RunE:  cmdListLogic,
 	}
+	cmd.Flags().BoolVar(&listTree, "tree", false, "Show the dependency tree of every task")
+	cmd.Flags().BoolVar(&listJSON, "json", false, "Print tasks as JSON")
+	cmd.Flags().StringArrayVarP(&listTags, "tag", "t", nil, "Only tasks with this tag. Can be repeated (any of the tags matches).")
+	return cmd
 }
 
 func cmdShow() *cobra.Command {
-	return &cobra.Command{
-		Use:   "show [task]",
+	cmd := &cobra.Command{
+		Use:   "show [task [args...]] [-- cli-args...]",
 		Short: "Show task details",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MinimumNArgs(1),
 		RunE:  cmdShowLogic,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return getTaskNameCompletions(toComplete)
+		},
+	}
+	cmd.Flags().BoolVar(&showResolved, "resolved", false, "Render templates with the run's vars and show the effective dir and env")
+	cmd.Flags().BoolVar(&showJSON, "json", false, "Print the task as JSON")
+	return cmd
+}
+
+func cmdValidate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config and report every problem found",
+		Args:  cobra.NoArgs,
+		RunE:  cmdValidateLogic,
+		// problems are the output here, not a usage error
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.Flags().StringVar(&validateFormat, "format", "text", "Output format: text or json")
+	return cmd
+}
+
+func cmdGraph() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph [task...]",
+		Short: "Print the task graph (deps and post-tasks) as DOT, Mermaid or JSON",
+		RunE:  cmdGraphLogic,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return getTaskNameCompletions(toComplete)
+		},
+	}
+	cmd.Flags().StringVar(&graphFormat, "format", "dot", "Output format: dot, mermaid or json")
+	cmd.Flags().BoolVar(&graphWaves, "waves", false, "Group tasks into waves (tasks of a wave depend only on earlier waves)")
+	return cmd
+}
+
+func cmdSchema() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON Schema of wrkit.yaml for editors",
+		Args:  cobra.NoArgs,
+		RunE:  cmdSchemaLogic,
 	}
 }
 
@@ -1,9 +1,9 @@
 package src
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -18,78 +18,173 @@ func cmdRootLogic(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	}
 	// If --mode not provided, looking for at least one argument - task name.
-	if len(args) < 1 {
+	if len(args) == 0 || cmd.ArgsLenAtDash() == 0 {
 		return cmd.Help()
 	}
-	taskName := args[0]
-	cfg, err := LoadCombinedConfig(cfgFile, noMaster)
-	if err != nil {
-		return err
-	}
-	varsMap := parseVars(varsSlice)
-	return RunTaskByName(cfg, taskName, dryRun, verbose, varsMap)
+	return runTasksFromArgs(cmd, args)
 }
 
 // cmdRunLogic - main function for cmdRun command
-func cmdRunLogic(_ *cobra.Command, args []string) error {
-	taskName := args[0]
+func cmdRunLogic(cmd *cobra.Command, args []string) error {
+	return runTasksFromArgs(cmd, args)
+}
+
+// cmdWatchLogic - main function for cmdWatch command
+func cmdWatchLogic(cmd *cobra.Command, args []string) error {
+	watchMode = true
+	return runTasksFromArgs(cmd, args)
+}
+
+// runTasksFromArgs runs tasks named in positional args, shared by root, run and watch commands
+func runTasksFromArgs(cmd *cobra.Command, args []string) error {
 	cfg, err := LoadCombinedConfig(cfgFile, noMaster)
 	if err != nil {
 		return err
 	}
-	varsMap := parseVars(varsSlice)
-	return RunTaskByName(cfg, taskName, dryRun, verbose, varsMap)
+	calls, cliArgs, err := parseTaskCalls(cfg, cmd, args)
+	if err != nil {
+		return err
+	}
+	opts := runOptions()
+	opts.CLIArgs = cliArgs
+	if watchMode {
+		return WatchTasks(cfg, calls, opts, debounce)
+	}
+	return RunTasks(cfg, calls, opts)
 }
 
 // cmdListLogic - main function for cmdList command
-func cmdListLogic(_ *cobra.Command, _ []string) error {
-	cfg, err := LoadCombinedConfig(cfgFile, noMaster)
+func cmdListLogic(_ *cobra.Command, args []string) error {
+	cfg, err := loadResolvedConfig()
 	if err != nil {
 		return err
 	}
-	for name, t := range cfg.Tasks {
-		desc := t.Desc
-		if desc == "" {
-			desc = "-"
+	names, err := filterTasks(cfg, args, listTags)
+	if err != nil {
+		return err
+	}
+	if listJSON {
+		entries := make([]listEntry, 0, len(names))
+		for _, name := range names {
+			entries = append(entries, newListEntry(name, cfg.Tasks[name]))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	nameWidth := 20
+	for _, name := range names {
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+	}
+	for _, name := range names {
+		printTaskLine(name, cfg.Tasks[name], nameWidth)
+		if listTree {
+			printDepTree(cfg, name, "  ", map[string]bool{})
 		}
-		fmt.Printf("%-20s %s\n", name, desc)
 	}
 	return nil
 }
 
 // cmdShowLogic - main function for cmdShow command
-func cmdShowLogic(_ *cobra.Command, args []string) error {
+func cmdShowLogic(cmd *cobra.Command, args []string) error {
 	name := args[0]
 	cfg, err := LoadCombinedConfig(cfgFile, noMaster)
 	if err != nil {
 		return err
 	}
-	t, ok := cfg.Tasks[name]
-	if !ok {
-		return fmt.Errorf("task %q not found", name)
+	positional, cliArgs := args[1:], []string(nil)
+	if dash := cmd.ArgsLenAtDash(); dash >= 1 {
+		positional, cliArgs = args[1:dash], args[dash:]
 	}
-	fmt.Printf("name: %s\n", name)
-	fmt.Printf("desc: %s\n", t.Desc)
-	fmt.Printf("dir:  %s\n", t.Dir)
-	if len(t.Deps) > 0 {
-		fmt.Printf("deps: %s\n", strings.Join(t.Deps, ", "))
+	if !showResolved && (len(positional) > 0 || len(cliArgs) > 0) {
+		return fmt.Errorf("task args are used only with --resolved")
 	}
-	if len(t.Cmds) > 0 {
-		fmt.Println("cmds:")
-		for _, c := range t.Cmds {
-			fmt.Printf("  - %s\n", c)
-		}
+	v, err := newTaskView(cfg, name, showResolved, positional, cliArgs, parseVars(varsSlice))
+	if err != nil {
+		return err
+	}
+	if showJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
 	}
-	if len(t.Env) > 0 {
-		fmt.Println("env:")
-		for k, v := range t.Env {
-			fmt.Printf("  %s=%s\n", k, v)
+	printTaskView(v)
+	return nil
+}
+
+// cmdValidateLogic - main function for cmdValidate command
+func cmdValidateLogic(_ *cobra.Command, _ []string) error {
+	if validateFormat != "text" && validateFormat != "json" {
+		return fmt.Errorf("unknown format %q (expected text or json)", validateFormat)
+	}
+	var problems []Problem
+	cfg, err := loadCombinedConfig(cfgFile, noMaster)
+	if err != nil {
+		// the file could not be read or parsed at all
+		problems = append(problems, asProblem(err))
+	} else {
+		problems = ValidateConfig(cfg, parseVars(varsSlice))
+	}
+
+	if validateFormat == "json" {
+		if problems == nil {
+			problems = []Problem{}
 		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Valid    bool      `json:"valid"`
+			Problems []Problem `json:"problems"`
+		}{len(problems) == 0, problems})
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+	if validateFormat == "text" {
+		fmt.Println("config is valid")
 	}
-	fmt.Printf("parallel: %v\n", t.Parallel)
 	return nil
 }
 
+// cmdGraphLogic - main function for cmdGraph command
+func cmdGraphLogic(_ *cobra.Command, args []string) error {
+	cfg, err := loadResolvedConfig()
+	if err != nil {
+		return err
+	}
+	g, err := BuildGraph(cfg)
+	if err != nil {
+		return err
+	}
+	v, err := newGraphView(g, args)
+	if err != nil {
+		return err
+	}
+	switch graphFormat {
+	case "dot":
+		return writeGraphDOT(os.Stdout, v, graphWaves)
+	case "mermaid":
+		return writeGraphMermaid(os.Stdout, v, graphWaves)
+	case "json":
+		return writeGraphJSON(os.Stdout, v)
+	}
+	return fmt.Errorf("unknown format %q (expected dot, mermaid or json)", graphFormat)
+}
+
+// cmdSchemaLogic - main function for cmdSchema command
+func cmdSchemaLogic(_ *cobra.Command, _ []string) error {
+	return writeSchema(os.Stdout)
+}
+
 // cmdInitLogic - main function for cmdInit command
 func cmdInitLogic(_ *cobra.Command, _ []string) error {
 	if _, err := os.Stat("wrkit.yaml"); err == nil {
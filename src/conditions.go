@@ -0,0 +1,69 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// checkConditions evaluates `if` and preconditions of the task.
+// It returns a non-empty skip reason when the task should be skipped
+// quietly, or an error when a precondition aborts the task.
+func checkConditions(ctx context.Context, t *TaskConfig, vars map[string]string, opts RunOptions) (string, error) {
+	if t.If != "" {
+		ok, _, err := evalCondition(ctx, t, t.If, vars, opts)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return fmt.Sprintf("if `%s` is false", t.If), nil
+		}
+	}
+	for _, p := range t.Preconditions {
+		ok, cond, err := evalCondition(ctx, t, p.Sh, vars, opts)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			continue
+		}
+		msg := p.Msg
+		if msg == "" {
+			msg = fmt.Sprintf("`%s`", cond)
+		}
+		if p.OnFail == "skip" {
+			return "precondition failed: " + msg, nil
+		}
+		return "", fmt.Errorf("precondition failed: %s", msg)
+	}
+	return "", nil
+}
+
+// evalCondition renders the snippet and runs it with `sh -c`; it holds when
+// the exit code is 0. Template expressions rendering to true/false are
+// decided without starting a shell.
+func evalCondition(ctx context.Context, t *TaskConfig, raw string, vars map[string]string, opts RunOptions) (bool, string, error) {
+	cond, err := renderTemplate(raw, vars)
+	if err != nil {
+		return false, "", err
+	}
+	cond = strings.TrimSpace(cond)
+	switch cond {
+	case "true":
+		return true, cond, nil
+	case "false", "":
+		return false, cond, nil
+	}
+	cmd := shellCommand(t, cond)
+	err = runCommand(ctx, cmd, false, opts.GracePeriod)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, cond, nil
+	}
+	if err != nil {
+		return false, cond, fmt.Errorf("condition %q: %w", cond, err)
+	}
+	return true, cond, nil
+}
@@ -31,7 +31,7 @@ tasks:
 const cmdRootLongDescription = `wrkit — a small, fast task runner driven by YAML files.
 
 Behavior:
-  * If --mode (or -m) is provided, wrkit expects a subcommand (run, list, show, init, version).
+  * If --mode (or -m) is provided, wrkit expects a subcommand (run, watch, list, show, validate, graph, schema, init, version).
     Examples:
       wrkit --mode run task-name
       wrkit -m init
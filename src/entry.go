@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -13,6 +14,10 @@ func Entrypoint() {
 	// Need this, to register subcommands only then user provided --mode flag.
 	modeFlag = false
 	for _, a := range os.Args[1:] {
+		if a == "--" {
+			// everything after `--` belongs to the task
+			break
+		}
 		if a == "-m" || a == "--mode" || strings.HasPrefix(a, "-m=") || strings.HasPrefix(a, "--mode=") {
 			modeFlag = true
 			break
@@ -24,30 +29,41 @@ func Entrypoint() {
 		if modeFlag {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
-		if len(args) == 0 {
-			return getTaskNameCompletions(toComplete)
-		}
-		return nil, cobra.ShellCompDirectiveNoFileComp
+		return getTaskNameCompletions(toComplete)
 	}
 
 	// Common persistent-flags (will be available in subcommands and base modes both).
-	cmdRoot.PersistentFlags().StringVarP(&cfgFile, "file", "f", "wrkit.yaml", "wrkit YAML configuration file")
+	cmdRoot.PersistentFlags().StringVarP(&cfgFile, "file", "f", "", "wrkit YAML configuration file (default: wrkit.yaml, wrkit.yml or .wrkit.yaml in the current or a parent directory)")
 	cmdRoot.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", 4, "Number of tasks to run concurrently")
+	cmdRoot.PersistentFlags().BoolVarP(&keepGoing, "keep-going", "k", false, "Keep running independent tasks after a failure and report all results")
+	cmdRoot.PersistentFlags().DurationVar(&gracePeriod, "grace-period", 5*time.Second, "Time to wait after SIGINT/SIGTERM before killing cancelled tasks")
+	cmdRoot.PersistentFlags().DurationVar(&runTimeout, "timeout", 0, "Time limit for the whole run, e.g. 10m (0 — no limit)")
+	cmdRoot.PersistentFlags().BoolVar(&force, "force", false, "Run tasks even if their sources are up to date")
 	cmdRoot.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print what would be done without executing")
 	cmdRoot.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	cmdRoot.PersistentFlags().StringArrayVarP(&varsSlice, "var", "V", []string{}, "Variables to pass to templates (key=value). Can be repeated.")
+	cmdRoot.PersistentFlags().StringVar(&outputMode, "output", "", "Output of task commands: interleaved, prefixed or grouped (default: as configured, interleaved)")
+	cmdRoot.PersistentFlags().StringVar(&runFormat, "output-format", "text", "Run log format: text, or json for one JSON event per line")
+	cmdRoot.PersistentFlags().BoolVar(&timings, "timings", false, "Print wall time of every task and the critical path after the run")
+	cmdRoot.PersistentFlags().StringVar(&traceFile, "trace", "", "Write a Chrome trace of the run to this file (open in Perfetto or chrome://tracing)")
+	cmdRoot.PersistentFlags().BoolVar(&watchMode, "watch", false, "Run again whenever files in sources or watch of the tasks change")
+	cmdRoot.PersistentFlags().DurationVar(&debounce, "debounce", 200*time.Millisecond, "With --watch: wait this long after the last change before restarting")
 	cmdRoot.PersistentFlags().BoolVar(&noMaster, "no-master", false, "Ignore global ~/.wrkit.master.yaml and use only local wrkit.yaml")
 
 	// Registering flag --mode / -m; default value — result of os.Args check.
 	cmdRoot.PersistentFlags().BoolVarP(&modeFlag, "mode", "m", modeFlag,
-		"Enable subcommand mode. When set, use subcommands (run, list, show, init, version).\n"+
+		"Enable subcommand mode. When set, use subcommands (run, watch, list, show, validate, graph, schema, init, version).\n"+
 			"When omitted, the first positional argument is treated as a task name (wrkit <task-name>).")
 
 	// Registering subcommands only when --mode provided
 	if modeFlag {
 		cmdRoot.AddCommand(cmdRun())
+		cmdRoot.AddCommand(cmdWatch())
 		cmdRoot.AddCommand(cmdList())
 		cmdRoot.AddCommand(cmdShow())
+		cmdRoot.AddCommand(cmdValidate())
+		cmdRoot.AddCommand(cmdGraph())
+		cmdRoot.AddCommand(cmdSchema())
 		cmdRoot.AddCommand(cmdInit())
 		cmdRoot.AddCommand(cmdVersion())
 	}
@@ -0,0 +1,135 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Output formats of a run
+const (
+	formatText = "text"
+	formatJSON = "json" // one Event per line on stdout
+)
+
+// Event — one line of the `--output-format json` stream. Type is one of:
+// run_start, wave_start, task_start, task_finish, command_start,
+// command_finish, output, retry, post_task, run_finish, and watch_change
+// between runs of `--watch`.
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Task     string    `json:"task,omitempty"`
+	Kind     string    `json:"kind,omitempty"` // deps-task, main-task, post-task:<when>
+	Roots    []string  `json:"roots,omitempty"`
+	Tasks    []string  `json:"tasks,omitempty"` // run_start: every task of the run; wave_start: tasks of the wave
+	Wave     int       `json:"wave,omitempty"`  // 1-based
+	Parallel bool      `json:"parallel,omitempty"`
+	Cmd      string    `json:"cmd,omitempty"`
+	Stream   string    `json:"stream,omitempty"` // output: stdout, stderr
+	Line     *string   `json:"line,omitempty"`
+
+	// post_task: whether the post-task of Root runs, and why
+	Root   string `json:"root,omitempty"`
+	When   string `json:"when,omitempty"`
+	Run    *bool  `json:"run,omitempty"`
+	Reason string `json:"reason,omitempty"` // also the skip reason of task_finish
+
+	Attempt  int `json:"attempt,omitempty"`
+	Attempts int `json:"attempts,omitempty"`
+
+	// task_finish: ok, failed, skipped, up_to_date, dry_run; run_finish: ok, failed, interrupted
+	Status     string `json:"status,omitempty"`
+	DurationMs *int64 `json:"duration_ms,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	Outputs map[string]string `json:"outputs,omitempty"` // task_finish: captured outputs of the task
+
+	// run_finish
+	Succeeded []string `json:"succeeded,omitempty"`
+	Failed    []string `json:"failed,omitempty"`
+	Skipped   []string `json:"skipped,omitempty"`
+
+	CriticalPath []string `json:"critical_path,omitempty"` // run_finish: chain of deps with the longest wall time
+
+	Files []string `json:"files,omitempty"` // watch_change: files that changed since the previous run
+}
+
+// eventLog writes events as JSON lines; a nil log drops them
+type eventLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventLog(w io.Writer) *eventLog {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &eventLog{enc: enc}
+}
+
+func (l *eventLog) emit(e Event) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(e)
+}
+
+// durationMs returns the time since start in milliseconds
+func durationMs(start time.Time) *int64 {
+	ms := time.Since(start).Milliseconds()
+	return &ms
+}
+
+// exitCode returns the exit code of a failed command in err's chain, if any
+func exitCode(err error) *int {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil
+	}
+	code := exitErr.ExitCode()
+	return &code
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// waveTracker emits wave_start when the first task of a wave starts.
+// The scheduler does not wait for whole waves, so waves may overlap.
+type waveTracker struct {
+	mu      sync.Mutex
+	waves   [][]string
+	waveOf  map[string]int
+	started map[int]bool
+}
+
+func newWaveTracker(waves [][]string) *waveTracker {
+	w := &waveTracker{waves: waves, waveOf: map[string]int{}, started: map[int]bool{}}
+	for i, wave := range waves {
+		for _, name := range wave {
+			w.waveOf[name] = i + 1
+		}
+	}
+	return w
+}
+
+func (w *waveTracker) taskStarted(name string, opts RunOptions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wave := w.waveOf[name]
+	if wave == 0 || w.started[wave] {
+		return
+	}
+	w.started[wave] = true
+	opts.emit(Event{Type: "wave_start", Wave: wave, Tasks: w.waves[wave-1]})
+}
@@ -2,195 +2,435 @@ package src
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"sync"
+	"strings"
+	"time"
 )
 
-func RunTaskByName(cfg *Config, name string, dryRun bool, verbose bool, vars map[string]string) error {
+// RunOptions holds run-wide settings passed from the CLI to the executor
+type RunOptions struct {
+	DryRun      bool
+	Verbose     bool
+	Concurrency int
+	KeepGoing   bool
+	Force       bool          // ignore up-to-date checks
+	GracePeriod time.Duration // time between SIGTERM/SIGINT and SIGKILL on cancellation
+	Timeout     time.Duration // limit for the whole task graph, post-tasks excluded
+	Vars        map[string]string
+	CLIArgs     []string // everything after `--`, exposed as {{.CLI_ARGS}}
+	Output      string   // output mode for every task, overrides the config; "" — as configured
+	Format      string   // text (default) or json: Event lines instead of human-readable messages
+	Timings     bool     // print wall time of every task and the critical path after the run
+	Trace       string   // file for a Chrome trace of the run, "" — none
+
+	events  *eventLog   // set by RunTasks for the json format
+	timer   *runTimer   // set by RunTasks
+	outputs *runOutputs // set by RunTasks
+}
+
+// printf prints a human-readable message; the json format has events instead
+func (o RunOptions) printf(format string, args ...interface{}) {
+	if o.events == nil {
+		fmt.Printf(format, args...)
+	}
+}
+
+func (o RunOptions) emit(e Event) {
+	o.events.emit(e)
+}
+
+// TaskCall — root task requested from the command line with values for its declared args
+type TaskCall struct {
+	Name string
+	Args []string
+}
+
+// RunTaskByName runs a single task with its dependencies and post-tasks
+func RunTaskByName(cfg *Config, name string, opts RunOptions) error {
+	return RunTasks(cfg, []TaskCall{{Name: name}}, opts)
+}
+
+// RunTasks runs several root tasks over one combined graph: shared
+// dependencies run once, every root gets its own post-tasks.
+func RunTasks(cfg *Config, calls []TaskCall, opts RunOptions) error {
+	return runTasksContext(context.Background(), cfg, calls, opts)
+}
+
+// runPlan — graph, tasks and vars of a run of calls
+type runPlan struct {
+	g        *TaskGraph
+	roots    []string
+	subgraph []string // roots with their transitive deps in execution order
+	scope    varScope
+}
+
+// newRunPlan renders templated task names and builds the graph of the tasks
+// that will run. Dynamic vars are evaluated with ctx.
+func newRunPlan(ctx context.Context, cfg *Config, calls []TaskCall, opts RunOptions) (*runPlan, error) {
+	// values from the command line win over vars of any file
+	overrides := map[string]string{"CLI_ARGS": shellJoin(opts.CLIArgs)}
+	for k, v := range opts.Vars {
+		overrides[k] = v
+	}
+	scope := newVarScope(cfg, overrides)
+	scope.dyn = newDynamicVars(ctx, opts.GracePeriod)
+
+	cfg, roots, err := callInstances(cfg, calls, opts.Vars)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err = resolveTaskNames(cfg, scope, roots)
+	if err != nil {
+		return nil, err
+	}
 	g, err := BuildGraph(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	subgraph, err := g.CollectSubgraph(name)
+	subgraph, err := g.CollectSubgraph(roots...)
 	if err != nil {
-		return err
+		if cfg.path == "" {
+			return nil, fmt.Errorf("%w (no wrkit.yaml found in the current directory or its parents)", err)
+		}
+		return nil, err
 	}
+	return &runPlan{g: g, roots: roots, subgraph: subgraph, scope: scope}, nil
+}
 
-	mergedVars := MergeVars(cfg, vars)
+// runTasksContext is RunTasks stopped early when parent is cancelled,
+// e.g. by `--watch` restarting the run
+func runTasksContext(parent context.Context, cfg *Config, calls []TaskCall, opts RunOptions) error {
+	dryRun := opts.DryRun
+
+	if opts.Output != "" {
+		if err := (&OutputConfig{Mode: opts.Output}).Validate(); err != nil {
+			return err
+		}
+	}
+	switch opts.Format {
+	case "", formatText:
+	case formatJSON:
+		opts.events = newEventLog(os.Stdout)
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", opts.Format)
+	}
+
+	// The run context is cancelled by the first SIGINT/SIGTERM, the post context —
+	// by the second one, so post-tasks still get a chance to clean up.
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+	postCtx, cancelPost := context.WithCancelCause(context.Background())
+	defer cancelPost(nil)
+	stopSignals := watchSignals(cancel, cancelPost)
+	defer stopSignals()
+	ctx, stopTimeout := withTimeout(ctx, opts.Timeout, "run")
+	defer stopTimeout()
+
+	plan, err := newRunPlan(ctx, cfg, calls, opts)
+	if err != nil {
+		return err
+	}
+	g, roots, subgraph, scope := plan.g, plan.roots, plan.subgraph, plan.scope
 
 	// Определяем тип каждой задачи: deps-task или main-task
 	taskType := make(map[string]string)
 	for _, t := range subgraph {
 		taskType[t] = "deps-task"
 	}
-	if len(subgraph) > 0 {
-		taskType[name] = "main-task"
+	for _, r := range roots {
+		taskType[r] = "main-task"
 	}
 
-	// Fetching dependency waves
-	waves, err := g.WavesFor(name)
-	if err != nil {
-		return err
+	concurrency := opts.Concurrency
+	if dryRun {
+		// nothing is executed, keep the printed plan stable
+		concurrency = 1
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	started := time.Now()
+	opts.timer = newRunTimer()
+	opts.outputs = newRunOutputs()
+	opts.emit(Event{Type: "run_start", Roots: roots, Tasks: subgraph})
+	waves := newWaveTracker(g.Waves(subgraph))
 
-	// Для отслеживания успешности выполнения задач
-	taskResults := make(map[string]error)
+	s := newScheduler(g, subgraph, concurrency, opts.KeepGoing)
+	taskResults, err := s.Run(ctx, func(ctx context.Context, n *TaskNode) error {
+		tType := taskType[n.Name]
+		waves.taskStarted(n.Name, opts)
+		opts.emit(Event{Type: "task_start", Task: n.Name, Kind: tType, Parallel: n.Cfg.Parallel})
+		taskStarted := time.Now()
+		span := opts.timer.startTask(n.Name, tType, n.Cfg.Parallel)
+		status, reason := "failed", ""
+		vars, err := scope.forTask(n.Cfg)
+		if err == nil {
+			deps, _ := g.CollectSubgraph(n.Name)
+			vars = opts.outputs.varsFor(vars, deps[:len(deps)-1])
+			// dir and env may refer to outputs of the deps
+			rn := *n
+			if rn.Cfg, err = renderTaskEnv(n.Cfg, vars); err == nil {
+				status, reason, err = runTask(ctx, cfg, &rn, tType, vars, opts)
+			}
+		}
+		opts.timer.finishTask(span, status, err)
+		opts.emit(Event{
+			Type: "task_finish", Task: n.Name, Kind: tType, Status: status, Reason: reason,
+			DurationMs: durationMs(taskStarted), ExitCode: exitCode(err), Error: errString(err),
+			Outputs: opts.outputs.get(n.Name),
+		})
+		return err
+	})
+	if opts.KeepGoing && !dryRun {
+		printRunSummary(subgraph, taskResults, opts)
+	}
+	runErr := err
+	var ie *interruptError
+	interrupted := errors.As(context.Cause(ctx), &ie) || errors.Is(context.Cause(ctx), errRestart)
 
-	for waveIdx, wave := range waves {
-		if verbose {
-			fmt.Printf("\n[wave %d] %v\n", waveIdx+1, wave)
+	// После выполнения основных задач — запустить их post-tasks.
+	// A failed dependency counts as a failure of the root; after an
+	// interrupt only `when: always` post-tasks are run.
+	seenRoots := map[string]bool{}
+	for _, root := range roots {
+		if seenRoots[root] {
+			continue
+		}
+		seenRoots[root] = true
+		if err := runPostTasks(postCtx, g, root, taskResults[root], interrupted, scope, opts); err != nil {
+			return err
 		}
+	}
 
-		var parallelBatch []*TaskNode
-		var wg sync.WaitGroup
-		errCh := make(chan error, len(wave))
-		resultMu := sync.Mutex{}
+	if opts.Timings && !dryRun {
+		opts.timer.printTimings(g, subgraph, opts)
+	}
+	if opts.Trace != "" {
+		if err := opts.timer.writeTrace(opts.Trace); err != nil && runErr == nil {
+			runErr = fmt.Errorf("write trace: %w", err)
+		}
+	}
+	if opts.events != nil {
+		failed, skipped, succeeded := splitResults(subgraph, taskResults)
+		criticalPath, _ := opts.timer.criticalPath(g, subgraph)
+		status := "ok"
+		switch {
+		case interrupted:
+			status = "interrupted"
+		case runErr != nil:
+			status = "failed"
+		}
+		opts.emit(Event{
+			Type: "run_finish", Status: status, DurationMs: durationMs(started), Error: errString(runErr),
+			Succeeded: succeeded, Failed: failed, Skipped: skipped, CriticalPath: criticalPath,
+		})
+	}
+	return runErr
+}
 
-		runParallelBatch := func() error {
-			if len(parallelBatch) == 0 {
-				return nil
-			}
-			if verbose {
-				var names []string
-				for _, n := range parallelBatch {
-					names = append(names, n.Name)
-				}
-				fmt.Printf("→ running parallel group: %v\n", names)
-			}
-			for _, node := range parallelBatch {
-				wg.Add(1)
-				go func(n *TaskNode) {
-					defer wg.Done()
-					tType := taskType[n.Name]
-					if tType == "" {
-						tType = "deps-task"
-					}
-					if dryRun {
-						fmt.Printf("[dry-run][%s] task %s\n", tType, n.Name)
-						resultMu.Lock()
-						taskResults[n.Name] = nil
-						resultMu.Unlock()
-						return
-					}
-					if verbose {
-						fmt.Printf("→ [%s] (par) %s\n", tType, n.Name)
-					} else {
-						fmt.Printf("→ [%s] %s\n", tType, n.Name)
-					}
-					err := executeTaskCommands(ctx, n, mergedVars, verbose, tType)
-					resultMu.Lock()
-					taskResults[n.Name] = err
-					resultMu.Unlock()
-					if err != nil {
-						errCh <- fmt.Errorf("task %s failed: %w", n.Name, err)
-					}
-				}(node)
-			}
-			wg.Wait()
-			close(errCh)
-			for e := range errCh {
-				if e != nil {
-					return e
-				}
-			}
-			parallelBatch = nil
-			return nil
+// runTask runs one node of the graph: conditions, up-to-date check, commands.
+// It returns the task_finish status and the reason of a skip.
+func runTask(ctx context.Context, cfg *Config, n *TaskNode, tType string, vars map[string]string, opts RunOptions) (string, string, error) {
+	dryRun, verbose := opts.DryRun, opts.Verbose
+	skipReason, err := checkConditions(ctx, n.Cfg, vars, opts)
+	if err != nil {
+		return "failed", "", err
+	}
+	if skipReason != "" {
+		if dryRun {
+			opts.printf("[dry-run][%s] task %s (skipped: %s)\n", tType, n.Name, skipReason)
+		} else if verbose {
+			opts.printf("→ [%s] %s skipped: %s\n", tType, n.Name, skipReason)
+		}
+		return "skipped", skipReason, nil
+	}
+	upToDate, fingerprint, err := checkUpToDate(cfg.StateRoot(), n.Name, n.Cfg, vars)
+	if err != nil {
+		return "failed", "", err
+	}
+	if upToDate && !opts.Force {
+		if dryRun {
+			opts.printf("[dry-run][%s] task %s (up to date)\n", tType, n.Name)
+			return "up_to_date", "", nil
+		}
+		opts.printf("→ [%s] %s (up to date)\n", tType, n.Name)
+		if err := storeOutputs(ctx, n, vars, opts); err != nil {
+			return "failed", "", err
+		}
+		return "up_to_date", "", nil
+	}
+	if dryRun {
+		opts.printf("[dry-run][%s] task %s\n", tType, n.Name)
+		return "dry_run", "", nil
+	}
+	if verbose {
+		mode := "seq"
+		if n.Cfg.Parallel {
+			mode = "par"
 		}
+		opts.printf("→ [%s] (%s) %s\n", tType, mode, n.Name)
+	} else {
+		opts.printf("→ [%s] %s\n", tType, n.Name)
+	}
+	if err := executeTaskCommands(ctx, n, vars, opts, tType); err != nil {
+		return "failed", "", err
+	}
+	if err := storeOutputs(ctx, n, vars, opts); err != nil {
+		return "failed", "", err
+	}
+	if fingerprint != "" {
+		if err := saveTaskState(cfg.StateRoot(), n.Name, n.Cfg, fingerprint); err != nil {
+			return "failed", "", err
+		}
+	}
+	return "ok", "", nil
+}
 
-		for _, taskName := range wave {
-			node := g.Nodes[taskName]
-			tType := taskType[node.Name]
-			if tType == "" {
-				tType = "deps-task"
-			}
+// storeOutputs captures the outputs of a task that succeeded or is up to date
+func storeOutputs(ctx context.Context, n *TaskNode, vars map[string]string, opts RunOptions) error {
+	if len(n.Cfg.Outputs) == 0 {
+		return nil
+	}
+	values, err := captureOutputs(ctx, n.Cfg, vars, opts)
+	if err != nil {
+		return err
+	}
+	opts.outputs.set(n.Name, values)
+	if opts.Verbose {
+		for _, name := range sortedOutputNames(n.Cfg) {
+			opts.printf("  %s.%s = %q\n", n.Name, name, values[name])
+		}
+	}
+	return nil
+}
 
-			if node.Cfg.Parallel {
-				parallelBatch = append(parallelBatch, node)
-				continue
+// runPostTasks runs post-tasks of root according to their `when` and the root's result
+func runPostTasks(ctx context.Context, g *TaskGraph, root string, rootErr error, interrupted bool, scope varScope, opts RunOptions) error {
+	dryRun, verbose := opts.DryRun, opts.Verbose
+	for _, post := range g.Nodes[root].Cfg.Post {
+		shouldRun := false
+		whenType := normalizeWhen(post.When)
+		var reason string
+		switch whenType {
+		case "success":
+			shouldRun = rootErr == nil
+			reason = "task succeeded"
+			if !shouldRun {
+				reason = "task failed"
 			}
-
-			if err := runParallelBatch(); err != nil {
+		case "always":
+			shouldRun = true
+			reason = "always"
+		case "fail":
+			shouldRun = rootErr != nil && !interrupted
+			switch {
+			case shouldRun:
+				reason = "task failed"
+			case interrupted:
+				reason = "run interrupted"
+			default:
+				reason = "task succeeded"
+			}
+		default:
+			opts.emit(Event{Type: "post_task", Task: post.Name, Root: root, When: post.When, Run: &shouldRun, Reason: "unknown when"})
+			_, err := fmt.Fprintf(os.Stderr, "Unknown 'when' value for post-task %q: %q (skipped)\n", post.Name, post.When)
+			if err != nil {
 				return err
 			}
+			continue
+		}
+		opts.emit(Event{Type: "post_task", Task: post.Name, Root: root, When: whenType, Run: &shouldRun, Reason: reason})
+		if !shouldRun {
 			if verbose {
-				fmt.Printf("→ [%s] (seq) %s\n", tType, node.Name)
-			} else {
-				fmt.Printf("→ [%s] %s\n", tType, node.Name)
+				opts.printf("[post-task:%s] skipping %s (when=%s)\n", whenType, post.Name, post.When)
 			}
-			if dryRun {
-				fmt.Printf("[dry-run][%s] task %s\n", tType, node.Name)
-				taskResults[node.Name] = nil
-				continue
+			continue
+		}
+		postNode, ok := g.Nodes[post.Name]
+		if !ok {
+			return fmt.Errorf("post-task %q of task %q is not a task", post.Name, root)
+		}
+		logPrefix := fmt.Sprintf("[post-task:%s]", whenType)
+		if dryRun {
+			opts.printf("[dry-run]%s task %s\n", logPrefix, post.Name)
+			continue
+		}
+		if verbose {
+			opts.printf("→ %s running %s (when=%s)\n", logPrefix, post.Name, post.When)
+		} else {
+			opts.printf("→ %s %s\n", logPrefix, post.Name)
+		}
+		kind := fmt.Sprintf("post-task:%s", whenType)
+		opts.emit(Event{Type: "task_start", Task: post.Name, Kind: kind})
+		postStarted := time.Now()
+		span := opts.timer.startTask(post.Name, kind, postNode.Cfg.Parallel)
+		// the root and its deps are done, their outputs are available
+		vars, err := scope.forTask(postNode.Cfg)
+		if err == nil {
+			deps, _ := g.CollectSubgraph(root)
+			vars = opts.outputs.varsFor(vars, deps)
+			pn := *postNode
+			if pn.Cfg, err = renderTaskEnv(postNode.Cfg, vars); err == nil {
+				err = executeTaskCommands(ctx, &pn, vars, opts, kind)
 			}
-			err := executeTaskCommands(ctx, node, mergedVars, verbose, tType)
-			taskResults[node.Name] = err
+		}
+		status := "ok"
+		if err != nil {
+			status = "failed"
+		}
+		opts.timer.finishTask(span, status, err)
+		opts.emit(Event{
+			Type: "task_finish", Task: post.Name, Kind: kind, Status: status,
+			DurationMs: durationMs(postStarted), ExitCode: exitCode(err), Error: errString(err),
+		})
+		if err != nil {
+			_, err := fmt.Fprintf(os.Stderr, "Post-task %q failed: %v\n", post.Name, err)
 			if err != nil {
-				return fmt.Errorf("task %s failed: %w", node.Name, err)
+				return err
 			}
 		}
+	}
+	return nil
+}
 
-		if err := runParallelBatch(); err != nil {
-			return err
+// splitResults sorts tasks by their result, keeping execution order
+func splitResults(order []string, results map[string]error) (failed, skipped, succeeded []string) {
+	for _, name := range order {
+		switch err := results[name]; {
+		case err == nil:
+			succeeded = append(succeeded, name)
+		case errors.Is(err, errSkipped):
+			skipped = append(skipped, name)
+		default:
+			failed = append(failed, name)
 		}
 	}
+	return failed, skipped, succeeded
+}
 
-	// После выполнения основной задачи — запустить post-tasks
-	if mainNode, ok := g.Nodes[name]; ok && len(mainNode.Cfg.Post) > 0 {
-		mainTaskErr := taskResults[name]
-		for _, post := range mainNode.Cfg.Post {
-			shouldRun := false
-			whenType := normalizeWhen(post.When)
-			switch whenType {
-			case "success":
-				shouldRun = mainTaskErr == nil
-			case "always":
-				shouldRun = true
-			case "fail":
-				shouldRun = mainTaskErr != nil
-			default:
-				_, err := fmt.Fprintf(os.Stderr, "Unknown 'when' value for post-task %q: %q (skipped)\n", post.Name, post.When)
-				if err != nil {
-					return err
-				}
-				continue
-			}
-			if !shouldRun {
-				if verbose {
-					fmt.Printf("[post-task:%s] skipping %s (when=%s)\n", whenType, post.Name, post.When)
-				}
-				continue
-			}
-			postNode, ok := g.Nodes[post.Name]
-			if !ok {
-				_, err := fmt.Fprintf(os.Stderr, "Post-task %q not found (skipped)\n", post.Name)
-				if err != nil {
-					return err
-				}
-				continue
-			}
-			logPrefix := fmt.Sprintf("[post-task:%s]", whenType)
-			if verbose {
-				fmt.Printf("→ %s running %s (when=%s)\n", logPrefix, post.Name, post.When)
-			} else {
-				fmt.Printf("→ %s %s\n", logPrefix, post.Name)
-			}
-			err := executeTaskCommands(ctx, postNode, mergedVars, verbose, fmt.Sprintf("post-task:%s", whenType))
-			if err != nil {
-				_, err := fmt.Fprintf(os.Stderr, "Post-task %q failed: %v\n", post.Name, err)
-				if err != nil {
-					return err
-				}
-			}
+// printRunSummary prints failed, skipped and succeeded tasks in execution order
+func printRunSummary(order []string, results map[string]error, opts RunOptions) {
+	failed, skipped, succeeded := splitResults(order, results)
+	opts.printf("\nsummary:\n")
+	for _, row := range []struct {
+		title string
+		names []string
+	}{
+		{"failed", failed},
+		{"skipped", skipped},
+		{"succeeded", succeeded},
+	} {
+		list := "-"
+		if len(row.names) > 0 {
+			list = strings.Join(row.names, ", ")
 		}
+		opts.printf("  %-10s %d: %s\n", row.title, len(row.names), list)
+	}
+	for _, name := range failed {
+		opts.printf("  ✗ %s: %v\n", name, results[name])
 	}
-
-	return nil
 }
 
 // normalizeWhen приводит when к одному из: success, fail, always
@@ -207,39 +447,107 @@ func normalizeWhen(when string) string {
 	}
 }
 
-func executeTaskCommands(ctx context.Context, node *TaskNode, vars map[string]string, verbose bool, taskType string) error {
+func executeTaskCommands(ctx context.Context, node *TaskNode, vars map[string]string, opts RunOptions, taskType string) error {
 	t := node.Cfg
-	for _, rawCmd := range t.Cmds {
-		cmdStr, err := renderTemplate(rawCmd, vars)
-		if err != nil {
-			return err
-		}
-		if verbose {
-			fmt.Printf("[cmd][%s] %s\n", taskType, cmdStr)
-		}
-		// split shell? use `sh -c` to allow pipelines and shell features
-		// set up exec.Cmd
-		// change dir if specified
-		cmd := exec.CommandContext(ctx, "sh", "-c", cmdStr)
-		if t.Dir != "" {
-			cmd.Dir = t.Dir
-		} else {
-			// default to current working dir
-			cmd.Dir, _ = os.Getwd()
+	// Sequential tasks run alone and get the terminal while their commands
+	// run, parallel ones would fight over it.
+	foreground := !t.Parallel
+	out, err := newTaskOutput(node.Name, t, vars, opts)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	onRetry := func(attempt, attempts int, err error, delay time.Duration) {
+		opts.printf("↻ [%s] %s attempt %d/%d failed: %v; retrying in %s\n", taskType, node.Name, attempt, attempts, err, delay)
+		opts.emit(Event{
+			Type: "retry", Task: node.Name, Kind: taskType, Attempt: attempt, Attempts: attempts,
+			ExitCode: exitCode(err), Error: err.Error(), Reason: "retrying in " + delay.String(),
+		})
+	}
+
+	if t.Retry != nil && t.Retry.Scope == "command" {
+		for _, c := range t.Cmds {
+			c := c
+			err := withRetry(ctx, t.Retry, func() error {
+				return executeCommand(ctx, node, c, vars, opts, taskType, foreground, out)
+			}, onRetry)
+			if err != nil {
+				return err
+			}
 		}
-		// merge environment: inherited + task env
-		env := os.Environ()
-		for k, v := range t.Env {
-			env = append(env, k+"="+v)
+		return nil
+	}
+	return withRetry(ctx, t.Retry, func() error {
+		for _, c := range t.Cmds {
+			if err := executeCommand(ctx, node, c, vars, opts, taskType, foreground, out); err != nil {
+				return err
+			}
 		}
-		cmd.Env = env
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		return nil
+	}, onRetry)
+}
+
+// executeCommand runs a single command of the node through `sh -c`, writing to out
+func executeCommand(ctx context.Context, node *TaskNode, c Command, vars map[string]string, opts RunOptions, taskType string, foreground bool, out *taskOutput) error {
+	t := node.Cfg
+	cmdStr, err := renderTemplate(c.Cmd, vars)
+	if err != nil {
+		return err
+	}
+	if opts.Verbose && opts.events == nil {
+		fmt.Fprintf(out.Stdout, "[cmd][%s] %s\n", taskType, cmdStr)
+	}
+	opts.emit(Event{Type: "command_start", Task: node.Name, Kind: taskType, Cmd: cmdStr})
+	started := time.Now()
+	span := opts.timer.startCommand(node.Name, taskType, cmdStr)
+	err = runShell(ctx, t, c, cmdStr, opts, foreground, out)
+	opts.timer.finishCommand(span, err)
+	opts.emit(Event{
+		Type: "command_finish", Task: node.Name, Kind: taskType, Cmd: cmdStr,
+		DurationMs: durationMs(started), ExitCode: exitCode(err), Error: errString(err),
+	})
+	return err
+}
+
+// runShell runs the rendered command with its timeout (or the task's one)
+func runShell(ctx context.Context, t *TaskConfig, c Command, cmdStr string, opts RunOptions, foreground bool, out *taskOutput) error {
+	cmd := shellCommand(t, cmdStr)
+	cmd.Stdout = out.Stdout
+	cmd.Stderr = out.Stderr
+	// reading the terminal outside of its foreground group stops with SIGTTIN
+	if foreground || !stdinIsTerminal() {
 		cmd.Stdin = os.Stdin
+	}
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("command %q failed: %w", cmdStr, err)
-		}
+	timeout := t.Timeout
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	cmdCtx, stop := withTimeout(ctx, timeout, "")
+	defer stop()
+	if err := runCommand(cmdCtx, cmd, foreground, opts.GracePeriod); err != nil {
+		return fmt.Errorf("command %q failed: %w", cmdStr, err)
 	}
 	return nil
 }
+
+// shellCommand prepares `sh -c cmdStr` in the task's dir and env
+func shellCommand(t *TaskConfig, cmdStr string) *exec.Cmd {
+	// split shell? use `sh -c` to allow pipelines and shell features
+	// set up exec.Cmd
+	// change dir if specified
+	cmd := exec.Command("sh", "-c", cmdStr)
+	if dir := t.WorkDir(); dir != "" {
+		cmd.Dir = dir
+	} else {
+		// default to current working dir
+		cmd.Dir, _ = os.Getwd()
+	}
+	// merge environment: inherited + task env
+	env := os.Environ()
+	for k, v := range t.Env {
+		env = append(env, k+"="+v)
+	}
+	cmd.Env = env
+	return cmd
+}
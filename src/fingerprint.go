@@ -0,0 +1,152 @@
+package src
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// stateDir keeps wrkit run state, next to the local config file
+const stateDir = ".wrkit"
+
+// taskState is stored in .wrkit/state/<task>.json after a successful run
+type taskState struct {
+	Method      string `json:"method"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func taskStatePath(root, name string) string {
+	return filepath.Join(root, stateDir, "state", unsafeFileChars.ReplaceAllString(name, "_")+".json")
+}
+
+// checkUpToDate reports whether the task can be skipped and returns the
+// current fingerprint to be saved after a successful run. Tasks without
+// sources are never up to date.
+func checkUpToDate(root, name string, t *TaskConfig, vars map[string]string) (bool, string, error) {
+	if len(t.Sources) == 0 {
+		return false, "", nil
+	}
+	fp, err := taskFingerprint(t, vars)
+	if err != nil {
+		return false, "", err
+	}
+
+	b, err := os.ReadFile(taskStatePath(root, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, fp, nil
+		}
+		return false, "", fmt.Errorf("read state of %s: %w", name, err)
+	}
+	var st taskState
+	if err := json.Unmarshal(b, &st); err != nil || st.Fingerprint != fp {
+		return false, fp, nil
+	}
+
+	// every generated pattern must still match something
+	for _, g := range t.Generates {
+		pattern, err := renderTemplate(g, vars)
+		if err != nil {
+			return false, "", err
+		}
+		files, err := globFiles(t.WorkDir(), []string{pattern})
+		if err != nil {
+			return false, "", err
+		}
+		if len(files) == 0 {
+			return false, fp, nil
+		}
+	}
+	return true, fp, nil
+}
+
+// saveTaskState remembers the fingerprint of a successful run
+func saveTaskState(root, name string, t *TaskConfig, fingerprint string) error {
+	path := taskStatePath(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("save state of %s: %w", name, err)
+	}
+	b, err := json.MarshalIndent(taskState{Method: orDefault(t.Method, "checksum"), Fingerprint: fingerprint}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// taskFingerprint hashes source files (content or mtime+size, depending on
+// method) together with rendered commands and env, so editing the task
+// itself also makes it stale.
+func taskFingerprint(t *TaskConfig, vars map[string]string) (string, error) {
+	patterns := make([]string, 0, len(t.Sources))
+	for _, s := range t.Sources {
+		p, err := renderTemplate(s, vars)
+		if err != nil {
+			return "", err
+		}
+		patterns = append(patterns, p)
+	}
+	files, err := globFiles(t.WorkDir(), patterns)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "method=%s\n", orDefault(t.Method, "checksum"))
+	for _, c := range t.Cmds {
+		cmdStr, err := renderTemplate(c.Cmd, vars)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "cmd=%s\n", cmdStr)
+	}
+	envKeys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	for _, k := range envKeys {
+		fmt.Fprintf(h, "env=%s=%s\n", k, t.Env[k])
+	}
+
+	for _, f := range files {
+		rel, err := filepath.Rel(orDefault(t.WorkDir(), "."), f)
+		if err != nil {
+			rel = f
+		}
+		if t.Method == "timestamp" {
+			fi, err := os.Stat(f)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "file=%s %d %d\n", filepath.ToSlash(rel), fi.ModTime().UnixNano(), fi.Size())
+			continue
+		}
+		sum, err := fileChecksum(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file=%s %s\n", filepath.ToSlash(rel), sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "src/a/b/main.go", true},
+		{"**/*.go", "src/main.txt", false},
+		{"src/**", "src", true},
+		{"src/**", "src/a/b", true},
+		{"src/**", "lib/a", false},
+		{"src/**/test/*.go", "src/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/test/a.go", true},
+		{"src/**/test/*.go", "src/x/test/y/a.go", false},
+		{"**", "any/thing", true},
+		{"a/?.go", "a/b.go", true},
+		{"a/[bc].go", "a/d.go", false},
+	}
+	for _, tt := range tests {
+		got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/"))
+		if got != tt.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"go.mod",
+		"main.go",
+		"src/a.go",
+		"src/a_test.go",
+		"src/deep/b.go",
+		"docs/readme.md",
+		".git/objects/x.go",
+		stateDir + "/state.go",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"plain glob", []string{"*.go"}, []string{"main.go"}},
+		{"recursive skips .git and state", []string{"**/*.go"}, []string{"main.go", "src/a.go", "src/a_test.go", "src/deep/b.go"}},
+		{"prefix before **", []string{"src/**/b.go"}, []string{"src/deep/b.go"}},
+		{"sorted without duplicates", []string{"src/*.go", "**/a.go", "go.mod"}, []string{"go.mod", "src/a.go", "src/a_test.go"}},
+		{"missing dir", []string{"nope/**/*.go"}, nil},
+		{"directories are not files", []string{"src"}, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := globFiles(dir, tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rel []string
+			for _, p := range got {
+				r, err := filepath.Rel(dir, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			if !reflect.DeepEqual(rel, tt.want) {
+				t.Errorf("globFiles(%q) = %q, want %q", tt.patterns, rel, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// graphView — part of the task graph prepared for export
+type graphView struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+	Waves [][]string  `json:"waves"`
+}
+
+type graphNode struct {
+	Name     string `json:"name"`
+	Desc     string `json:"desc,omitempty"`
+	Parallel bool   `json:"parallel"`
+	Wave     int    `json:"wave"` // 1-based, 0 — post-task outside of the deps subgraph
+}
+
+// graphEdge points in execution order: from a dep to the task that needs it,
+// or from a task to its post-task
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`           // dep, post
+	When string `json:"when,omitempty"` // post-tasks only: success, fail, always
+}
+
+// newGraphView collects the subgraph of roots (the whole graph if there are
+// none) together with the post-tasks of its tasks
+func newGraphView(g *TaskGraph, roots []string) (*graphView, error) {
+	tasks := g.Names()
+	if len(roots) > 0 {
+		var err error
+		if tasks, err = g.CollectSubgraph(roots...); err != nil {
+			return nil, err
+		}
+	}
+	v := &graphView{Waves: g.Waves(tasks)}
+	wave := map[string]int{}
+	for i, w := range v.Waves {
+		for _, name := range w {
+			wave[name] = i + 1
+		}
+	}
+
+	seen := map[string]bool{}
+	addNode := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		t := g.Nodes[name].Cfg
+		v.Nodes = append(v.Nodes, graphNode{Name: name, Desc: t.Desc, Parallel: t.Parallel, Wave: wave[name]})
+	}
+	for _, name := range tasks {
+		addNode(name)
+		for _, d := range g.Deps[name] {
+			v.Edges = append(v.Edges, graphEdge{From: d, To: name, Kind: "dep"})
+		}
+	}
+	for _, name := range tasks {
+		for _, p := range g.Nodes[name].Cfg.Post {
+			addNode(p.Name)
+			v.Edges = append(v.Edges, graphEdge{From: name, To: p.Name, Kind: "post", When: normalizeWhen(p.When)})
+		}
+	}
+	return v, nil
+}
+
+// writeGraphJSON writes the view as one JSON document
+func writeGraphJSON(w io.Writer, v *graphView) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeGraphDOT writes the view in Graphviz DOT; with waves every wave is a cluster
+func writeGraphDOT(w io.Writer, v *graphView, waves bool) error {
+	var b strings.Builder
+	b.WriteString("digraph wrkit {\n  rankdir=LR;\n  node [shape=box];\n")
+	node := func(indent string, n graphNode) {
+		attrs := []string{"label=" + strconv.Quote(n.Name)}
+		if n.Desc != "" {
+			attrs = append(attrs, "tooltip="+strconv.Quote(n.Desc))
+		}
+		if n.Parallel {
+			attrs = append(attrs, "style=rounded")
+		}
+		fmt.Fprintf(&b, "%s%s [%s];\n", indent, strconv.Quote(n.Name), strings.Join(attrs, ", "))
+	}
+	if waves {
+		for i := range v.Waves {
+			fmt.Fprintf(&b, "  subgraph cluster_wave_%d {\n    label=\"wave %d\";\n    style=dashed;\n", i+1, i+1)
+			for _, n := range v.Nodes {
+				if n.Wave == i+1 {
+					node("    ", n)
+				}
+			}
+			b.WriteString("  }\n")
+		}
+	}
+	for _, n := range v.Nodes {
+		if !waves || n.Wave == 0 {
+			node("  ", n)
+		}
+	}
+	for _, e := range v.Edges {
+		if e.Kind == "post" {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed, label=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.When))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeGraphMermaid writes the view as a Mermaid flowchart; with waves every wave is a subgraph
+func writeGraphMermaid(w io.Writer, v *graphView, waves bool) error {
+	// task names may contain `:` and `-`, mermaid ids get plain n0, n1, ...
+	ids := make(map[string]string, len(v.Nodes))
+	for i, n := range v.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+	}
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	node := func(indent string, n graphNode) {
+		label := strings.ReplaceAll(n.Name, `"`, "#quot;")
+		if n.Parallel {
+			fmt.Fprintf(&b, "%s%s([\"%s\"])\n", indent, ids[n.Name], label)
+		} else {
+			fmt.Fprintf(&b, "%s%s[\"%s\"]\n", indent, ids[n.Name], label)
+		}
+	}
+	if waves {
+		for i := range v.Waves {
+			fmt.Fprintf(&b, "  subgraph wave%d[\"wave %d\"]\n", i+1, i+1)
+			for _, n := range v.Nodes {
+				if n.Wave == i+1 {
+					node("    ", n)
+				}
+			}
+			b.WriteString("  end\n")
+		}
+	}
+	for _, n := range v.Nodes {
+		if !waves || n.Wave == 0 {
+			node("  ", n)
+		}
+	}
+	for _, e := range v.Edges {
+		if e.Kind == "post" {
+			fmt.Fprintf(&b, "  %s -. %s .-> %s\n", ids[e.From], e.When, ids[e.To])
+			continue
+		}
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[e.From], ids[e.To])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
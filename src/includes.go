@@ -0,0 +1,142 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// namespaceSep separates include namespace and task name: docker:build
+const namespaceSep = ":"
+
+// IncludeConfig — other wrkit file loaded under a namespace.
+// In YAML it is either a path or a mapping.
+type IncludeConfig struct {
+	Path     string `yaml:"path"`               // file or directory with wrkit.yaml, relative to the including file
+	Optional bool   `yaml:"optional,omitempty"` // missing file is not an error
+}
+
+func (i *IncludeConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&i.Path)
+	}
+	type rawInclude IncludeConfig
+	return node.Decode((*rawInclude)(i))
+}
+
+// loadIncludes loads every include of cfg (read from path) and adds its
+// tasks as `namespace:task`. Deps and post names of included tasks are
+// looked up in the included file first, then in the including one;
+// a leading `:` refers to the root file.
+func loadIncludes(cfg *Config, path string, stack []string) error {
+	if len(cfg.Includes) == 0 {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range stack {
+		if s == abs {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	namespaces := make([]string, 0, len(cfg.Includes))
+	for ns := range cfg.Includes {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		inc := cfg.Includes[ns]
+		if ns == "" || strings.Contains(ns, namespaceSep) {
+			return fmt.Errorf("%s: invalid include namespace %q", path, ns)
+		}
+		if inc.Path == "" {
+			return fmt.Errorf("%s: include %q has no path", path, ns)
+		}
+		incPath := inc.Path
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(filepath.Dir(path), incPath)
+		}
+		if fi, err := os.Stat(incPath); err == nil && fi.IsDir() {
+			incPath = filepath.Join(incPath, "wrkit.yaml")
+		}
+
+		// included tasks run relative to the included file
+		incCfg, err := loadConfigFile(incPath, filepath.Dir(incPath), stack)
+		if err != nil {
+			return fmt.Errorf("include %q: %w", ns, err)
+		}
+		if incCfg == nil {
+			if inc.Optional {
+				continue
+			}
+			return fmt.Errorf("include %q: file %s not found", ns, incPath)
+		}
+
+		cfg.problems = append(cfg.problems, incCfg.problems...)
+		for name, t := range incCfg.Tasks {
+			full := ns + namespaceSep + name
+			if _, exists := cfg.Tasks[full]; exists {
+				return fmt.Errorf("%s: task %q conflicts with included task", path, full)
+			}
+			for i, d := range t.Deps {
+				t.Deps[i].Task = scopedName(ns, d.Task, incCfg.Tasks)
+			}
+			for i := range t.Post {
+				t.Post[i].Name = scopedName(ns, t.Post[i].Name, incCfg.Tasks)
+			}
+			if hasTemplatedNames(t) {
+				ns, inner, local := ns, t.scopeName, incCfg.Tasks
+				t.scopeName = func(name string) string {
+					if inner != nil {
+						name = inner(name)
+					}
+					return scopedName(ns, name, local)
+				}
+			}
+			// vars of the included file apply to its tasks; deeper includes win
+			vars := make(map[string]Var, len(incCfg.Vars)+len(t.fileVars))
+			for k, v := range incCfg.Vars {
+				vars[k] = v
+			}
+			for k, v := range t.fileVars {
+				vars[k] = v
+			}
+			t.fileVars = vars
+			cfg.Tasks[full] = t
+		}
+	}
+	return nil
+}
+
+// scopedName prefixes name with ns if it refers to a task of the included
+// file; other names are left to be resolved by the including file
+func scopedName(ns, name string, local map[string]*TaskConfig) string {
+	if strings.HasPrefix(name, namespaceSep) {
+		return name
+	}
+	if _, ok := local[name]; ok {
+		return ns + namespaceSep + name
+	}
+	return name
+}
+
+// resolveRootNames strips the root marker `:` from deps and post names
+func resolveRootNames(cfg *Config) {
+	for _, t := range cfg.Tasks {
+		for i, d := range t.Deps {
+			t.Deps[i].Task = strings.TrimPrefix(d.Task, namespaceSep)
+		}
+		for i := range t.Post {
+			t.Post[i].Name = strings.TrimPrefix(t.Post[i].Name, namespaceSep)
+		}
+	}
+}
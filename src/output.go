@@ -0,0 +1,228 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output modes
+const (
+	outputInterleaved = "interleaved" // commands write straight to the terminal
+	outputPrefixed    = "prefixed"    // every line is tagged with [task]
+	outputGrouped     = "grouped"     // output is buffered and printed as one block when the task ends
+)
+
+// OutputConfig — how command output of a task is shown.
+// In YAML it is either a mode or a mapping with options.
+type OutputConfig struct {
+	Mode  string `yaml:"mode" enum:"interleaved,prefixed,grouped"`
+	Color bool   `yaml:"color,omitempty"` // prefixed: colour the [task] prefix
+	Begin string `yaml:"begin,omitempty"` // grouped: line before the block, e.g. ::group::{{.TASK}}
+	End   string `yaml:"end,omitempty"`   // grouped: line after the block, e.g. ::endgroup::
+}
+
+func (o *OutputConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&o.Mode)
+	}
+	type rawOutput OutputConfig
+	return node.Decode((*rawOutput)(o))
+}
+
+// Validate checks the output mode
+func (o *OutputConfig) Validate() error {
+	switch o.Mode {
+	case outputInterleaved, outputPrefixed, outputGrouped:
+		return nil
+	}
+	return fmt.Errorf("unknown output mode %q (expected interleaved, prefixed or grouped)", o.Mode)
+}
+
+// consoleMu serializes writes of prefixed lines and grouped blocks, so
+// parallel tasks never cut into each other's lines
+var consoleMu sync.Mutex
+
+// taskOutput — stdout and stderr for the commands of one task run
+type taskOutput struct {
+	Stdout, Stderr io.Writer
+	close          func()
+}
+
+// Close flushes whatever the task's commands left buffered
+func (o *taskOutput) Close() {
+	if o.close != nil {
+		o.close()
+	}
+}
+
+// newTaskOutput sets up output of task name: --output wins over the task's
+// own output (or the one of its file), the default is interleaved.
+// Begin/end markers are rendered with vars and {{.TASK}}.
+func newTaskOutput(name string, t *TaskConfig, vars map[string]string, opts RunOptions) (*taskOutput, error) {
+	if opts.events != nil {
+		// command output becomes `output` events
+		stdout := &lineWriter{emit: outputEvent(name, "stdout", opts)}
+		stderr := &lineWriter{emit: outputEvent(name, "stderr", opts)}
+		return &taskOutput{Stdout: stdout, Stderr: stderr, close: func() {
+			stdout.flush()
+			stderr.flush()
+		}}, nil
+	}
+	cfg := OutputConfig{Mode: outputInterleaved}
+	if t.Output != nil {
+		cfg = *t.Output
+	}
+	if opts.Output != "" {
+		cfg.Mode = opts.Output
+	}
+	switch cfg.Mode {
+	case outputPrefixed:
+		prefix := "[" + name + "] "
+		if cfg.Color && os.Getenv("NO_COLOR") == "" {
+			prefix = taskColor(name) + "[" + name + "]\x1b[0m "
+		}
+		stdout := &lineWriter{emit: prefixLine(os.Stdout, prefix)}
+		stderr := &lineWriter{emit: prefixLine(os.Stderr, prefix)}
+		return &taskOutput{Stdout: stdout, Stderr: stderr, close: func() {
+			stdout.flush()
+			stderr.flush()
+		}}, nil
+	case outputGrouped:
+		markerVars := make(map[string]string, len(vars)+1)
+		for k, v := range vars {
+			markerVars[k] = v
+		}
+		markerVars["TASK"] = name
+		begin, err := renderTemplate(orDefault(cfg.Begin, "── {{.TASK}}"), markerVars)
+		if err != nil {
+			return nil, err
+		}
+		end, err := renderTemplate(cfg.End, markerVars)
+		if err != nil {
+			return nil, err
+		}
+		g := &groupBuffer{}
+		return &taskOutput{Stdout: g.writer(false), Stderr: g.writer(true), close: func() {
+			g.print(begin, end)
+		}}, nil
+	}
+	return &taskOutput{Stdout: os.Stdout, Stderr: os.Stderr}, nil
+}
+
+// taskColors — ANSI colours for task prefixes, picked by a hash of the name
+var taskColors = []string{"\x1b[36m", "\x1b[33m", "\x1b[35m", "\x1b[32m", "\x1b[34m", "\x1b[31m"}
+
+func taskColor(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return taskColors[h.Sum32()%uint32(len(taskColors))]
+}
+
+// lineWriter passes complete lines, without the newline, to emit;
+// an unfinished line waits for its end or for flush
+type lineWriter struct {
+	emit func(line string) error
+	mu   sync.Mutex
+	buf  []byte
+}
+
+func (l *lineWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, b...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := l.emit(string(l.buf[:i])); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (l *lineWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		_ = l.emit(string(l.buf))
+		l.buf = nil
+	}
+}
+
+// prefixLine writes every line to w after prefix
+func prefixLine(w io.Writer, prefix string) func(string) error {
+	return func(line string) error {
+		consoleMu.Lock()
+		defer consoleMu.Unlock()
+		_, err := io.WriteString(w, prefix+line+"\n")
+		return err
+	}
+}
+
+// outputEvent turns every line into an `output` event of task name
+func outputEvent(name, stream string, opts RunOptions) func(string) error {
+	return func(line string) error {
+		opts.emit(Event{Type: "output", Task: name, Stream: stream, Line: &line})
+		return nil
+	}
+}
+
+// groupBuffer keeps stdout and stderr of a task in the order they were written
+type groupBuffer struct {
+	mu     sync.Mutex
+	chunks []groupChunk
+}
+
+type groupChunk struct {
+	stderr bool
+	data   []byte
+}
+
+type groupWriter struct {
+	g      *groupBuffer
+	stderr bool
+}
+
+func (g *groupBuffer) writer(stderr bool) io.Writer {
+	return groupWriter{g: g, stderr: stderr}
+}
+
+func (w groupWriter) Write(b []byte) (int, error) {
+	w.g.mu.Lock()
+	defer w.g.mu.Unlock()
+	w.g.chunks = append(w.g.chunks, groupChunk{stderr: w.stderr, data: append([]byte(nil), b...)})
+	return len(b), nil
+}
+
+// print writes the whole block at once: begin marker, the output, end marker
+func (g *groupBuffer) print(begin, end string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	if begin != "" {
+		fmt.Println(begin)
+	}
+	for i, c := range g.chunks {
+		w := os.Stdout
+		if c.stderr {
+			w = os.Stderr
+		}
+		_, _ = w.Write(c.data)
+		if i == len(g.chunks)-1 && len(c.data) > 0 && c.data[len(c.data)-1] != '\n' {
+			_, _ = w.Write([]byte{'\n'})
+		}
+	}
+	if end != "" {
+		fmt.Println(end)
+	}
+}
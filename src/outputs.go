@@ -0,0 +1,173 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OutputVar — value a task passes to the tasks depending on it, available
+// there as {{.deps.TASK.NAME}}: trimmed stdout of sh, or a key of a KEY=VALUE
+// file. In YAML a plain string is sh.
+type OutputVar struct {
+	Sh   string `yaml:"sh,omitempty" json:"sh,omitempty"`     // run after cmds in the task's dir and env
+	File string `yaml:"file,omitempty" json:"file,omitempty"` // KEY=VALUE lines, relative to the task's dir
+	Key  string `yaml:"key,omitempty" json:"key,omitempty"`   // key in file; default — the output name
+}
+
+func (o *OutputVar) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&o.Sh)
+	}
+	type rawOutputVar OutputVar
+	return node.Decode((*rawOutputVar)(o))
+}
+
+// outputName — output names have to work as {{.deps.task.NAME}}
+var outputName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks that exactly one source of the value is set
+func (o *OutputVar) Validate(name string) error {
+	if !outputName.MatchString(name) {
+		return fmt.Errorf("output %q: name must be letters, digits and _", name)
+	}
+	switch {
+	case o.Sh != "" && o.File != "":
+		return fmt.Errorf("output %q: set either sh or file, not both", name)
+	case o.Sh == "" && o.File == "":
+		return fmt.Errorf("output %q: sh or file is required", name)
+	case o.Key != "" && o.File == "":
+		return fmt.Errorf("output %q: key needs file", name)
+	}
+	return nil
+}
+
+// runOutputs keeps outputs captured during a run, by task
+type runOutputs struct {
+	mu     sync.Mutex
+	byTask map[string]map[string]string
+}
+
+func newRunOutputs() *runOutputs {
+	return &runOutputs{byTask: map[string]map[string]string{}}
+}
+
+func (r *runOutputs) set(task string, values map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byTask[task] = values
+}
+
+func (r *runOutputs) get(task string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byTask[task]
+}
+
+// varsFor returns vars with outputs of tasks added as deps.TASK.NAME
+func (r *runOutputs) varsFor(vars map[string]string, tasks []string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var merged map[string]string
+	for _, task := range tasks {
+		for name, v := range r.byTask[task] {
+			if merged == nil {
+				merged = make(map[string]string, len(vars)+1)
+				for k, val := range vars {
+					merged[k] = val
+				}
+			}
+			merged["deps."+task+"."+name] = v
+		}
+	}
+	if merged == nil {
+		return vars
+	}
+	return merged
+}
+
+func sortedOutputNames(t *TaskConfig) []string {
+	names := make([]string, 0, len(t.Outputs))
+	for name := range t.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// captureOutputs evaluates the outputs of a finished task, in name order
+func captureOutputs(ctx context.Context, t *TaskConfig, vars map[string]string, opts RunOptions) (map[string]string, error) {
+	values := make(map[string]string, len(t.Outputs))
+	for _, name := range sortedOutputNames(t) {
+		o := t.Outputs[name]
+		if o.Sh != "" {
+			cmdStr, err := renderTemplate(o.Sh, vars)
+			if err != nil {
+				return nil, fmt.Errorf("output %s: %w", name, err)
+			}
+			var stdout bytes.Buffer
+			cmd := shellCommand(t, cmdStr)
+			cmd.Stdout = &stdout
+			cmd.Stderr = os.Stderr
+			if err := runCommand(ctx, cmd, false, opts.GracePeriod); err != nil {
+				return nil, fmt.Errorf("output %s: command %q failed: %w", name, cmdStr, err)
+			}
+			values[name] = strings.TrimSpace(stdout.String())
+			continue
+		}
+		file, err := renderTemplate(o.File, vars)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(t.WorkDir(), file)
+		}
+		env, err := readEnvFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		key := orDefault(o.Key, name)
+		v, ok := env[key]
+		if !ok {
+			return nil, fmt.Errorf("output %s: no %s in %s", name, key, file)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
+
+// readEnvFile parses KEY=VALUE lines; blank lines, # comments and an
+// `export ` prefix are allowed, values may be quoted
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		values[strings.TrimSpace(k)] = v
+	}
+	return values, sc.Err()
+}
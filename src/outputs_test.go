@@ -0,0 +1,48 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"plain", "VERSION=1.2.3\nSHA=abc\n", map[string]string{"VERSION": "1.2.3", "SHA": "abc"}},
+		{"comments and blank lines", "# build info\n\n  VERSION=1\n", map[string]string{"VERSION": "1"}},
+		{"export prefix", "export VERSION=1\n", map[string]string{"VERSION": "1"}},
+		{"quotes", `A="two words"` + "\nB='single'\nC=\"unclosed\n", map[string]string{"A": "two words", "B": "single", "C": `"unclosed`}},
+		{"spaces around", " KEY = value \n", map[string]string{"KEY": "value"}},
+		{"value with =", "URL=http://x/?a=b\n", map[string]string{"URL": "http://x/?a=b"}},
+		{"empty value", "EMPTY=\nQUOTED=\"\"\n", map[string]string{"EMPTY": "", "QUOTED": ""}},
+		{"lines without = are ignored", "garbage\nK=v\n", map[string]string{"K": "v"}},
+		{"last one wins", "K=1\nK=2\n", map[string]string{"K": "2"}},
+		{"no trailing newline", "K=v", map[string]string{"K": "v"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.env")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readEnvFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readEnvFile(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readEnvFile(filepath.Join(t.TempDir(), "missing.env")); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,160 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// interruptError is the cancellation cause used when wrkit receives a signal
+type interruptError struct {
+	sig os.Signal
+}
+
+func (e *interruptError) Error() string {
+	return fmt.Sprintf("interrupted by signal: %s", e.sig)
+}
+
+// timeoutError is the cancellation cause used when a time limit is exceeded
+type timeoutError struct {
+	what string // optional prefix, e.g. "run"
+	d    time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	if e.what == "" {
+		return fmt.Sprintf("timed out after %s", e.d)
+	}
+	return fmt.Sprintf("%s timed out after %s", e.what, e.d)
+}
+
+// withTimeout returns ctx cancelled with timeoutError after d; d <= 0 means no limit.
+// Call stop to release the timer.
+func withTimeout(ctx context.Context, d time.Duration, what string) (_ context.Context, stop func()) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(d, func() {
+		cancel(&timeoutError{what: what, d: d})
+	})
+	return ctx, func() {
+		timer.Stop()
+		cancel(nil)
+	}
+}
+
+// watchSignals cancels run on the first SIGINT/SIGTERM and post on the second one.
+// Call stop to restore default signal handling.
+func watchSignals(run, post context.CancelCauseFunc) (stop func()) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		cancels := []context.CancelCauseFunc{run, post}
+		for len(cancels) > 0 {
+			select {
+			case sig := <-sigCh:
+				cancels[0](&interruptError{sig: sig})
+				cancels = cancels[1:]
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// stdinIsTerminal reports whether wrkit was started from an interactive terminal
+func stdinIsTerminal() bool {
+	return isTerminal(int(os.Stdin.Fd()))
+}
+
+// runCommand starts cmd and waits for it to finish.
+//
+// Every command gets its own process group, so signals reach every process
+// it spawned. A foreground command also gets the terminal while it runs,
+// if wrkit has it: Ctrl-C then goes to the command alone and wrkit passes
+// it on to itself once the command died from it. When ctx is cancelled the
+// group receives the signal wrkit was interrupted with (SIGTERM for any
+// other cause) and, if the command is still running after grace, SIGKILL.
+func runCommand(ctx context.Context, cmd *exec.Cmd, foreground bool, grace time.Duration) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	tty := -1
+	if foreground {
+		if fd, ok := foregroundTerminal(); ok {
+			tty = fd
+		}
+	}
+	isolateProcess(cmd, tty)
+	if err := cmd.Start(); err != nil {
+		if tty >= 0 {
+			takeTerminal(tty)
+		}
+		return err
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		if tty >= 0 {
+			takeTerminal(tty)
+		}
+		waitCh <- err
+	}()
+
+	select {
+	case err := <-waitCh:
+		if tty >= 0 && interruptedProcess(cmd) {
+			// sh starts background jobs with SIGINT ignored
+			_ = signalProcess(cmd, syscall.SIGKILL, true)
+			return raiseInterrupt(ctx, err)
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	cause := context.Cause(ctx)
+	var sig os.Signal = syscall.SIGTERM
+	var ie *interruptError
+	if errors.As(cause, &ie) {
+		sig = ie.sig
+	}
+	_ = signalProcess(cmd, sig, true)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-waitCh:
+	case <-timer.C:
+		_ = signalProcess(cmd, syscall.SIGKILL, true)
+		<-waitCh
+	}
+	// the leader is gone, make sure nothing it spawned is left behind
+	_ = signalProcess(cmd, syscall.SIGKILL, true)
+	return cause
+}
+
+// raiseInterrupt sends SIGINT to wrkit itself after the terminal's Ctrl-C
+// reached only a foreground command, and waits for watchSignals to cancel
+// ctx so the run is treated as interrupted rather than failed
+func raiseInterrupt(ctx context.Context, err error) error {
+	if interruptSelf() != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-time.After(time.Second):
+		return err
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package src
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// isolateProcess starts cmd in a new process group, made the foreground
+// group of the terminal tty unless tty is -1
+func isolateProcess(cmd *exec.Cmd, tty int) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if tty >= 0 {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = tty
+	}
+}
+
+// signalProcess sends sig to cmd, or to its whole process group if group is set
+func signalProcess(cmd *exec.Cmd, sig os.Signal, group bool) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		s = syscall.SIGTERM
+	}
+	pid := cmd.Process.Pid
+	if group {
+		pid = -pid
+	}
+	return syscall.Kill(pid, s)
+}
+
+// interruptedProcess reports whether the finished cmd was killed by SIGINT
+func interruptedProcess(cmd *exec.Cmd) bool {
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == syscall.SIGINT
+}
+
+// interruptSelf sends SIGINT to wrkit
+func interruptSelf() error {
+	return syscall.Kill(os.Getpid(), syscall.SIGINT)
+}
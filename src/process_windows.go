@@ -0,0 +1,26 @@
+//go:build windows
+
+package src
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// isolateProcess is a no-op: Windows has no POSIX process groups
+func isolateProcess(_ *exec.Cmd, _ int) {}
+
+// signalProcess terminates cmd, Windows can not deliver POSIX signals
+func signalProcess(cmd *exec.Cmd, _ os.Signal, _ bool) error {
+	return cmd.Process.Kill()
+}
+
+// interruptedProcess: commands never get the terminal here
+func interruptedProcess(_ *exec.Cmd) bool {
+	return false
+}
+
+func interruptSelf() error {
+	return errors.New("not supported on windows")
+}
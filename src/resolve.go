@@ -0,0 +1,279 @@
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxInstances limits tasks made from deps with vars, so a task calling
+// itself with ever new vars fails instead of growing the graph forever
+const maxInstances = 1000
+
+// hasTemplatedNames reports whether deps or post names of t are templates
+func hasTemplatedNames(t *TaskConfig) bool {
+	for _, d := range t.Deps {
+		if strings.Contains(d.Task, "{{") {
+			return true
+		}
+	}
+	for _, p := range t.Post {
+		if strings.Contains(p.Name, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDepVars reports whether any dep of t passes vars
+func hasDepVars(t *TaskConfig) bool {
+	for _, d := range t.Deps {
+		if len(d.Vars) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceName names the graph node of task called with vars: task[K=V,...]
+// with keys sorted; without vars it is the task itself
+func instanceName(task string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return task
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + vars[k]
+	}
+	return task + "[" + strings.Join(pairs, ",") + "]"
+}
+
+// callInstances binds args of every call and returns cfg with a task for each
+// call with positional values, named by instanceName, whose call vars are
+// those values; so `wrkit copy a b copy c d` runs copy twice. The returned
+// names of the calls' tasks are the roots of the run.
+func callInstances(cfg *Config, calls []TaskCall, cliVars map[string]string) (*Config, []string, error) {
+	out := *cfg
+	out.Tasks = make(map[string]*TaskConfig, len(cfg.Tasks))
+	for k, v := range cfg.Tasks {
+		out.Tasks[k] = v
+	}
+	roots := make([]string, 0, len(calls))
+	for _, c := range calls {
+		t, ok := cfg.Tasks[c.Name]
+		if !ok {
+			roots = append(roots, c.Name) // reported by CollectSubgraph
+			continue
+		}
+		args, err := BindTaskArgs(c.Name, t, c.Args, cliVars)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := instanceName(c.Name, args)
+		if _, exists := out.Tasks[name]; !exists {
+			it := *t
+			it.instanceOf = c.Name
+			it.callVars = args
+			out.Tasks[name] = &it
+		}
+		roots = append(roots, name)
+	}
+	return &out, roots, nil
+}
+
+// resolveTaskNames renders templated deps and post names of the tasks
+// reachable from roots (of every task when roots is nil), so the graph can be
+// built from them; only vars these names refer to are evaluated. A dep
+// rendered to "" is dropped, which allows {{if .X}}task{{end}}. A dep with
+// vars becomes a task of its own, named by instanceName, which is resolved in
+// turn with those vars. Tasks without templates are shared with cfg.
+// Without scope.dyn, deps and post-tasks whose names need a var computed by
+// sh are left out.
+func resolveTaskNames(cfg *Config, scope varScope, roots []string) (*Config, error) {
+	queue := roots
+	if roots == nil {
+		queue = cfg.TaskNames()
+	}
+	out := *cfg
+	out.Tasks = make(map[string]*TaskConfig, len(cfg.Tasks))
+	for k, v := range cfg.Tasks {
+		out.Tasks[k] = v
+	}
+
+	visited := map[string]bool{}
+	instances := 0
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		t, ok := out.Tasks[name]
+		if !ok || visited[name] {
+			continue // unknown names are reported by the graph
+		}
+		visited[name] = true
+		if !hasTemplatedNames(t) && !hasDepVars(t) {
+			for _, d := range t.Deps {
+				queue = append(queue, d.Task)
+			}
+			for _, p := range t.Post {
+				queue = append(queue, p.Name)
+			}
+			continue
+		}
+
+		vars, err := scope.forFields(t, taskNameFields(t))
+		if err != nil {
+			return nil, fmt.Errorf("task %q: %w", name, err)
+		}
+		var unknown map[string]Var // sh vars left unevaluated
+		if scope.dyn == nil {
+			unknown = scope.dynamicDefs(t)
+		}
+
+		rt := *t
+		rt.Deps = nil
+		for _, d := range t.Deps {
+			texts := []string{d.Task}
+			for _, v := range d.Vars {
+				texts = append(texts, v)
+			}
+			if refersToAny(unknown, texts...) {
+				continue
+			}
+			dep, err := renderTaskName(t, d.Task, vars)
+			if err != nil {
+				return nil, fmt.Errorf("task %q: dep: %w", name, err)
+			}
+			if dep == "" {
+				continue
+			}
+			base, known := cfg.Tasks[dep]
+			if len(d.Vars) > 0 && known {
+				callVars := make(map[string]string, len(d.Vars))
+				for k, v := range d.Vars {
+					if callVars[k], err = renderTemplate(v, vars); err != nil {
+						return nil, fmt.Errorf("task %q: dep %s: var %s: %w", name, dep, k, err)
+					}
+				}
+				inst := instanceName(dep, callVars)
+				if _, exists := out.Tasks[inst]; !exists {
+					if instances++; instances > maxInstances {
+						return nil, fmt.Errorf("task %q: more than %d deps with distinct vars, does a task call itself with new vars?", dep, maxInstances)
+					}
+					it := *base
+					it.instanceOf = dep
+					it.callVars = callVars
+					out.Tasks[inst] = &it
+				}
+				dep = inst
+			}
+			rt.Deps = append(rt.Deps, TaskDep{Task: dep})
+			queue = append(queue, dep)
+		}
+		rt.Post = nil
+		for _, p := range t.Post {
+			if refersToAny(unknown, p.Name) {
+				continue
+			}
+			post, err := renderTaskName(t, p.Name, vars)
+			if err != nil {
+				return nil, fmt.Errorf("task %q: post: %w", name, err)
+			}
+			if post == "" {
+				return nil, fmt.Errorf("task %q: post-task %q renders to an empty name", name, p.Name)
+			}
+			p.Name = post
+			rt.Post = append(rt.Post, p)
+			queue = append(queue, post)
+		}
+		out.Tasks[name] = &rt
+	}
+	return &out, nil
+}
+
+// refersToAny reports whether any of texts refers to a var of vars
+func refersToAny(vars map[string]Var, texts ...string) bool {
+	for _, text := range texts {
+		for _, ref := range templateRefs(text) {
+			if _, ok := vars[ref]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderTaskName renders a dep or post name of t; names from an included
+// file are then resolved in its namespace, like plain ones at load time
+func renderTaskName(t *TaskConfig, name string, vars map[string]string) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+	rendered, err := renderTemplate(name, vars)
+	if err != nil {
+		return "", err
+	}
+	rendered = strings.TrimSpace(rendered)
+	if rendered != "" && t.scopeName != nil {
+		rendered = t.scopeName(rendered)
+	}
+	return rendered, nil
+}
+
+// hasTemplatedEnv reports whether dir or env values of t are templates
+func hasTemplatedEnv(t *TaskConfig) bool {
+	templated := strings.Contains(t.Dir, "{{")
+	for _, v := range t.Env {
+		templated = templated || strings.Contains(v, "{{")
+	}
+	return templated
+}
+
+// resolveTask returns t with dir and env values rendered with the task's
+// vars, without outputs of deps; a run renders them with renderTaskEnv once
+// the deps are done
+func resolveTask(t *TaskConfig, scope varScope) (*TaskConfig, error) {
+	if !hasTemplatedEnv(t) {
+		return t, nil
+	}
+	vars, err := scope.forTask(t)
+	if err != nil {
+		return nil, err
+	}
+	return renderTaskEnv(t, vars)
+}
+
+// renderTaskEnv returns t with dir and env values rendered with vars
+func renderTaskEnv(t *TaskConfig, vars map[string]string) (*TaskConfig, error) {
+	if !hasTemplatedEnv(t) {
+		return t, nil
+	}
+	var err error
+	rt := *t
+	if rt.Dir, err = renderTemplate(t.Dir, vars); err != nil {
+		return nil, fmt.Errorf("dir: %w", err)
+	}
+	rt.Env = make(map[string]string, len(t.Env))
+	for k, v := range t.Env {
+		if rt.Env[k], err = renderTemplate(v, vars); err != nil {
+			return nil, fmt.Errorf("env %s: %w", k, err)
+		}
+	}
+	return &rt, nil
+}
+
+// loadResolvedConfig loads the config with templated task names rendered
+// with --var values, for commands that show the graph
+func loadResolvedConfig() (*Config, error) {
+	cfg, err := LoadCombinedConfig(cfgFile, noMaster)
+	if err != nil {
+		return nil, err
+	}
+	overrides := parseVars(varsSlice)
+	overrides["CLI_ARGS"] = ""
+	return resolveTaskNames(cfg, newVarScope(cfg, overrides), nil)
+}
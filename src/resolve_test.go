@@ -0,0 +1,188 @@
+package src
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCallInstances(t *testing.T) {
+	cfg := &Config{Tasks: map[string]*TaskConfig{
+		"greet": {Args: []TaskArg{{Name: "WHO", Default: "world"}}},
+		"bye":   {Args: []TaskArg{{Name: "WHO", Required: true}}},
+		"copy":  {Args: []TaskArg{{Name: "FROM"}, {Name: "TO"}}},
+	}}
+	tests := []struct {
+		name      string
+		calls     []TaskCall
+		cliVars   map[string]string
+		wantRoots []string
+		wantVars  map[string]map[string]string // call vars by root
+		wantErr   bool
+	}{
+		{
+			name:      "without values the task itself",
+			calls:     []TaskCall{{Name: "greet"}},
+			wantRoots: []string{"greet"},
+		},
+		{
+			name:      "values of each call",
+			calls:     []TaskCall{{Name: "greet", Args: []string{"bob"}}, {Name: "bye", Args: []string{"alice"}}},
+			wantRoots: []string{"greet[WHO=bob]", "bye[WHO=alice]"},
+			wantVars: map[string]map[string]string{
+				"greet[WHO=bob]": {"WHO": "bob"},
+				"bye[WHO=alice]": {"WHO": "alice"},
+			},
+		},
+		{
+			name:      "one task called twice",
+			calls:     []TaskCall{{Name: "copy", Args: []string{"a", "b"}}, {Name: "copy", Args: []string{"c", "d"}}},
+			wantRoots: []string{"copy[FROM=a,TO=b]", "copy[FROM=c,TO=d]"},
+			wantVars: map[string]map[string]string{
+				"copy[FROM=a,TO=b]": {"FROM": "a", "TO": "b"},
+				"copy[FROM=c,TO=d]": {"FROM": "c", "TO": "d"},
+			},
+		},
+		{
+			name:      "same values share a task",
+			calls:     []TaskCall{{Name: "copy", Args: []string{"a"}}, {Name: "copy", Args: []string{"a"}}},
+			wantRoots: []string{"copy[FROM=a]", "copy[FROM=a]"},
+			wantVars:  map[string]map[string]string{"copy[FROM=a]": {"FROM": "a"}},
+		},
+		{
+			name:      "required arg from --var",
+			calls:     []TaskCall{{Name: "bye"}},
+			cliVars:   map[string]string{"WHO": "x"},
+			wantRoots: []string{"bye"},
+		},
+		{name: "missing required arg", calls: []TaskCall{{Name: "bye"}}, wantErr: true},
+		{name: "too many values", calls: []TaskCall{{Name: "greet", Args: []string{"a", "b"}}}, wantErr: true},
+		{name: "unknown task is left to the graph", calls: []TaskCall{{Name: "nope"}}, wantRoots: []string{"nope"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			out, roots, err := callInstances(cfg, tt.calls, tt.cliVars)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(roots, tt.wantRoots) {
+				t.Errorf("roots = %q, want %q", roots, tt.wantRoots)
+			}
+			for root, want := range tt.wantVars {
+				task, ok := out.Tasks[root]
+				if !ok {
+					t.Fatalf("no task %s", root)
+				}
+				if !reflect.DeepEqual(task.callVars, want) {
+					t.Errorf("%s: call vars = %q, want %q", root, task.callVars, want)
+				}
+			}
+			if len(cfg.Tasks) != 3 {
+				t.Errorf("cfg got %d tasks, want it unchanged", len(cfg.Tasks))
+			}
+		})
+	}
+}
+
+func TestResolveInstances(t *testing.T) {
+	call := func(task string, vars map[string]string) TaskDep {
+		return TaskDep{Task: task, Vars: vars}
+	}
+	tests := []struct {
+		name      string
+		callers   map[string][]TaskDep
+		wantNodes []string // subgraph of every caller, sorted
+		wantVars  map[string]map[string]string
+	}{
+		{
+			name:      "distinct vars are distinct tasks",
+			callers:   map[string][]TaskDep{"all": {call("build", map[string]string{"OS": "linux"}), call("build", map[string]string{"OS": "mac"})}},
+			wantNodes: []string{"all", "build[OS=linux]", "build[OS=mac]"},
+			wantVars:  map[string]map[string]string{"build[OS=linux]": {"OS": "linux"}, "build[OS=mac]": {"OS": "mac"}},
+		},
+		{
+			name: "same vars share a task",
+			callers: map[string][]TaskDep{
+				"a": {call("build", map[string]string{"OS": "linux", "ARCH": "arm64"})},
+				"b": {call("build", map[string]string{"ARCH": "arm64", "OS": "linux"})},
+			},
+			wantNodes: []string{"a", "b", "build[ARCH=arm64,OS=linux]"},
+		},
+		{
+			name: "a call without vars is the task itself",
+			callers: map[string][]TaskDep{
+				"a": {call("build", nil)},
+				"b": {call("build", map[string]string{"OS": "linux"})},
+			},
+			wantNodes: []string{"a", "b", "build", "build[OS=linux]"},
+		},
+		{
+			name:      "vars are rendered with the caller's vars",
+			callers:   map[string][]TaskDep{"all": {call("build", map[string]string{"OS": "{{.TARGET}}"})}},
+			wantNodes: []string{"all", "build[OS=plan9]"},
+			wantVars:  map[string]map[string]string{"build[OS=plan9]": {"OS": "plan9"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Tasks: map[string]*TaskConfig{
+				"build": {Vars: map[string]Var{"OS": {Value: "linux"}}},
+			}}
+			var roots []string
+			for name, deps := range tt.callers {
+				cfg.Tasks[name] = &TaskConfig{Deps: deps, Vars: map[string]Var{"TARGET": {Value: "plan9"}}}
+				roots = append(roots, name)
+			}
+			out, err := resolveTaskNames(cfg, newVarScope(cfg, map[string]string{}), roots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := BuildGraph(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := g.CollectSubgraph(roots...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(nodes)
+			if !reflect.DeepEqual(nodes, tt.wantNodes) {
+				t.Errorf("nodes = %q, want %q", nodes, tt.wantNodes)
+			}
+			for name, want := range tt.wantVars {
+				if got := out.Tasks[name].callVars; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: call vars = %q, want %q", name, got, want)
+				}
+				if got := out.Tasks[name].instanceOf; got != "build" {
+					t.Errorf("%s: instance of %q, want build", name, got)
+				}
+			}
+			if names := out.TaskNames(); len(names) != len(cfg.Tasks) {
+				t.Errorf("task names = %q, instances should not be listed", names)
+			}
+		})
+	}
+}
+
+func TestResolveInstancesLimit(t *testing.T) {
+	// every call passes a new value to the task itself
+	cfg := &Config{Tasks: map[string]*TaskConfig{
+		"loop": {
+			Vars: map[string]Var{"N": {Value: "x"}},
+			Deps: []TaskDep{{Task: "loop", Vars: map[string]string{"N": "{{.N}}x"}}},
+		},
+	}}
+	_, err := resolveTaskNames(cfg, newVarScope(cfg, map[string]string{}), []string{"loop"})
+	if err == nil || !strings.Contains(err.Error(), "more than 1000 deps with distinct vars") {
+		t.Errorf("err = %v, want the instance limit", err)
+	}
+}
@@ -0,0 +1,69 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// withRetry runs fn according to policy; nil policy means a single run.
+// onRetry is called before every pause between attempts.
+func withRetry(ctx context.Context, policy *RetryConfig, fn func() error, onRetry func(attempt, attempts int, err error, delay time.Duration)) error {
+	attempts := 1
+	if policy != nil && policy.Attempts > 1 {
+		attempts = policy.Attempts
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !policy.retryable(ctx, err) {
+			return err
+		}
+		delay := policy.delayFor(attempt)
+		onRetry(attempt, attempts, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether err is worth another attempt
+func (r *RetryConfig) retryable(ctx context.Context, err error) bool {
+	// the run itself was cancelled, not the command
+	if ctx.Err() != nil {
+		return false
+	}
+	if len(r.ExitCodes) == 0 {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	for _, code := range r.ExitCodes {
+		if exitErr.ExitCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delayFor returns the pause after the given failed attempt (1-based)
+func (r *RetryConfig) delayFor(attempt int) time.Duration {
+	delay := r.Delay
+	if r.Backoff != "exponential" {
+		return delay
+	}
+	for i := 1; i < attempt && (r.MaxDelay == 0 || delay < r.MaxDelay); i++ {
+		delay *= 2
+	}
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,154 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// errSkipped marks tasks that were not started because of a failure
+var errSkipped = errors.New("skipped after a failure")
+
+// taskRunFunc executes a single graph node
+type taskRunFunc func(ctx context.Context, node *TaskNode) error
+
+type taskResult struct {
+	name string
+	err  error
+}
+
+// scheduler runs a subgraph as a worker pool: a task starts as soon as all
+// of its own deps are finished, parallel tasks share up to `concurrency`
+// slots, and non-parallel tasks always run alone.
+//
+// With keepGoing a failure does not stop the run: every task whose deps all
+// succeeded is still executed, and tasks downstream of a failure are skipped.
+type scheduler struct {
+	g           *TaskGraph
+	index       map[string]int // position in subgraph post-order, keeps ready queue stable
+	pending     map[string]int // number of unfinished deps
+	dependents  map[string][]string
+	concurrency int
+	keepGoing   bool
+}
+
+func newScheduler(g *TaskGraph, subgraph []string, concurrency int, keepGoing bool) *scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &scheduler{
+		g:           g,
+		index:       make(map[string]int, len(subgraph)),
+		pending:     make(map[string]int, len(subgraph)),
+		dependents:  make(map[string][]string, len(subgraph)),
+		concurrency: concurrency,
+		keepGoing:   keepGoing,
+	}
+	for i, name := range subgraph {
+		s.index[name] = i
+	}
+	for _, name := range subgraph {
+		for _, d := range g.Deps[name] {
+			if _, ok := s.index[d]; !ok {
+				continue
+			}
+			s.pending[name]++
+			s.dependents[d] = append(s.dependents[d], name)
+		}
+	}
+	return s
+}
+
+// Run executes every task of the subgraph and returns per-task results;
+// tasks that never started are reported with errSkipped.
+// Without keepGoing the first failure cancels the tasks still running and no
+// new tasks are started. Cancelling ctx stops the whole run.
+func (s *scheduler) Run(parent context.Context, run taskRunFunc) (map[string]error, error) {
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	results := make(map[string]error, len(s.index))
+	doneCh := make(chan taskResult)
+
+	var ready []string
+	for name := range s.index {
+		if s.pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	s.sortReady(ready)
+
+	running := 0
+	exclusive := false
+	var firstErr error
+	var failed []string
+
+	for running > 0 || (ctx.Err() == nil && len(ready) > 0) {
+		if ctx.Err() == nil {
+			for len(ready) > 0 {
+				node := s.g.Nodes[ready[0]]
+				if node.Cfg.Parallel {
+					if exclusive || running >= s.concurrency {
+						break
+					}
+				} else {
+					if running > 0 {
+						break
+					}
+					exclusive = true
+				}
+				ready = ready[1:]
+				running++
+				go func(n *TaskNode) {
+					doneCh <- taskResult{name: n.Name, err: run(ctx, n)}
+				}(node)
+			}
+		}
+
+		res := <-doneCh
+		running--
+		if !s.g.Nodes[res.name].Cfg.Parallel {
+			exclusive = false
+		}
+		results[res.name] = res.err
+		if res.err != nil {
+			failed = append(failed, res.name)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("task %s failed: %w", res.name, res.err)
+				if !s.keepGoing {
+					cancel(firstErr)
+				}
+			}
+			continue
+		}
+		for _, d := range s.dependents[res.name] {
+			s.pending[d]--
+			if s.pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+		s.sortReady(ready)
+	}
+
+	for name := range s.index {
+		if _, ok := results[name]; !ok {
+			results[name] = errSkipped
+		}
+	}
+	if parent.Err() != nil {
+		return results, context.Cause(parent)
+	}
+	if s.keepGoing && len(failed) > 1 {
+		s.sortReady(failed)
+		return results, fmt.Errorf("%d tasks failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return results, firstErr
+}
+
+func (s *scheduler) sortReady(ready []string) {
+	sort.Slice(ready, func(i, j int) bool {
+		return s.index[ready[i]] < s.index[ready[j]]
+	})
+}
@@ -0,0 +1,244 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTask describes a task of a test graph
+type testTask struct {
+	deps     []string
+	parallel bool
+}
+
+func testGraph(t *testing.T, tasks map[string]testTask) (*TaskGraph, []string) {
+	t.Helper()
+	cfg := &Config{Tasks: map[string]*TaskConfig{}}
+	for name, tt := range tasks {
+		tc := &TaskConfig{Parallel: tt.parallel}
+		for _, d := range tt.deps {
+			tc.Deps = append(tc.Deps, TaskDep{Task: d})
+		}
+		cfg.Tasks[name] = tc
+	}
+	g, err := BuildGraph(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, g.dfsCollect(g.Names())
+}
+
+// runTracker records what ran and checks the scheduling rules while tasks run
+type runTracker struct {
+	mu          sync.Mutex
+	running     map[string]bool
+	finished    map[string]bool
+	started     []string
+	maxParallel int
+	violations  []string
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{running: map[string]bool{}, finished: map[string]bool{}}
+}
+
+func (r *runTracker) start(g *TaskGraph, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range g.Deps[name] {
+		if !r.finished[d] {
+			r.violations = append(r.violations, name+" started before its dep "+d)
+		}
+	}
+	for other := range r.running {
+		if !g.Nodes[name].Cfg.Parallel || !g.Nodes[other].Cfg.Parallel {
+			r.violations = append(r.violations, name+" runs together with "+other)
+		}
+	}
+	r.running[name] = true
+	r.started = append(r.started, name)
+	if len(r.running) > r.maxParallel {
+		r.maxParallel = len(r.running)
+	}
+}
+
+func (r *runTracker) finish(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, name)
+	r.finished[name] = true
+}
+
+func TestSchedulerConcurrency(t *testing.T) {
+	independent := map[string]testTask{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		independent[name] = testTask{parallel: true}
+	}
+	tests := []struct {
+		name        string
+		tasks       map[string]testTask
+		concurrency int
+		wantMax     int
+	}{
+		{"one slot", independent, 1, 1},
+		{"two slots", independent, 2, 2},
+		{"more slots than tasks", independent, 10, 6},
+		{"zero means one", independent, 0, 1},
+		{"deps limit parallelism", map[string]testTask{
+			"a": {parallel: true},
+			"b": {deps: []string{"a"}, parallel: true},
+			"c": {deps: []string{"b"}, parallel: true},
+		}, 4, 1},
+		{"non-parallel tasks run alone", map[string]testTask{
+			"a": {parallel: true},
+			"b": {parallel: true},
+			"c": {},
+			"d": {},
+			"e": {deps: []string{"c"}, parallel: true},
+		}, 4, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, order := testGraph(t, tt.tasks)
+			tr := newRunTracker()
+			results, err := newScheduler(g, order, tt.concurrency, false).Run(context.Background(), func(ctx context.Context, n *TaskNode) error {
+				tr.start(g, n.Name)
+				time.Sleep(20 * time.Millisecond)
+				tr.finish(n.Name)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			for _, v := range tr.violations {
+				t.Error(v)
+			}
+			if tr.maxParallel != tt.wantMax {
+				t.Errorf("max running = %d, want %d", tr.maxParallel, tt.wantMax)
+			}
+			if len(tr.started) != len(tt.tasks) {
+				t.Errorf("started %v, want all %d tasks", tr.started, len(tt.tasks))
+			}
+			for name, err := range results {
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	tasks := map[string]testTask{
+		"fail":      {parallel: true},
+		"slow":      {parallel: true},
+		"after":     {deps: []string{"fail"}, parallel: true},
+		"other":     {parallel: true},
+		"afterSlow": {deps: []string{"slow"}, parallel: true},
+	}
+	tests := []struct {
+		name      string
+		keepGoing bool
+		fails     []string
+		want      map[string]string // result by task: ok, failed, skipped, cancelled
+		wantErr   string
+	}{
+		{
+			name:  "fail fast cancels running tasks and skips the rest",
+			fails: []string{"fail"},
+			want: map[string]string{
+				"fail": "failed", "slow": "cancelled", "other": "cancelled",
+				"after": "skipped", "afterSlow": "skipped",
+			},
+			wantErr: "task fail failed: boom",
+		},
+		{
+			name:      "keep going skips only tasks downstream of a failure",
+			keepGoing: true,
+			fails:     []string{"fail"},
+			want: map[string]string{
+				"fail": "failed", "slow": "ok", "other": "ok",
+				"after": "skipped", "afterSlow": "ok",
+			},
+			wantErr: "task fail failed: boom",
+		},
+		{
+			name:      "keep going reports every failure",
+			keepGoing: true,
+			fails:     []string{"fail", "slow"},
+			want: map[string]string{
+				"fail": "failed", "slow": "failed", "other": "ok",
+				"after": "skipped", "afterSlow": "skipped",
+			},
+			wantErr: "2 tasks failed: fail, slow",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, order := testGraph(t, tasks)
+			fails := map[string]bool{}
+			for _, name := range tt.fails {
+				fails[name] = true
+			}
+			results, err := newScheduler(g, order, 4, tt.keepGoing).Run(context.Background(), func(ctx context.Context, n *TaskNode) error {
+				if fails[n.Name] {
+					if n.Name != "fail" {
+						time.Sleep(20 * time.Millisecond)
+					}
+					return errBoom
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+					return nil
+				}
+			})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				got := "ok"
+				switch err := results[name]; {
+				case errors.Is(err, errSkipped):
+					got = "skipped"
+				case errors.Is(err, context.Canceled):
+					got = "cancelled"
+				case errors.Is(err, errBoom):
+					got = "failed"
+				case err != nil:
+					got = err.Error()
+				}
+				if got != want {
+					t.Errorf("%s: %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerParentCancel(t *testing.T) {
+	g, order := testGraph(t, map[string]testTask{
+		"a": {},
+		"b": {deps: []string{"a"}},
+	})
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := errors.New("stopped")
+	results, err := newScheduler(g, order, 1, true).Run(ctx, func(ctx context.Context, n *TaskNode) error {
+		cancel(stop)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("err = %v, want the cancel cause", err)
+	}
+	if !errors.Is(results["b"], errSkipped) {
+		t.Errorf("b: %v, want skipped", results["b"])
+	}
+}
@@ -0,0 +1,128 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaURL — JSON Schema draft the generated schema follows
+const schemaURL = "http://json-schema.org/draft-07/schema#"
+
+// scalarForms are types whose UnmarshalYAML also accepts a scalar, with the
+// JSON types of that scalar
+var scalarForms = map[reflect.Type]interface{}{
+	reflect.TypeOf(Commands{}):      "string",
+	reflect.TypeOf(Command{}):       "string",
+	reflect.TypeOf(StringSlice{}):   "string",
+	reflect.TypeOf(Precondition{}):  "string",
+	reflect.TypeOf(IncludeConfig{}): "string",
+	reflect.TypeOf(OutputConfig{}):  "string",
+	reflect.TypeOf(OutputVar{}):     "string",
+	reflect.TypeOf(TaskDep{}):       "string",
+	reflect.TypeOf(Var{}):           []string{"string", "number", "boolean"},
+}
+
+// durationPattern matches values accepted by time.ParseDuration
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// ConfigSchema generates a JSON Schema of wrkit.yaml from the Config structs,
+// so it follows them without extra work. Fields are named by their yaml tag;
+// a field without omitempty is required, an `enum:"a,b"` tag lists allowed values.
+func ConfigSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	schema := structSchema(reflect.TypeOf(Config{}), defs)
+	schema["$schema"] = schemaURL
+	schema["title"] = "wrkit.yaml"
+	schema["description"] = "wrkit task runner configuration"
+	schema["definitions"] = defs
+	return schema
+}
+
+// writeSchema writes ConfigSchema as indented JSON, the form of wrkit.schema.json
+func writeSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(ConfigSchema())
+}
+
+// typeSchema returns the schema of typ; named structs are put into defs and referenced
+func typeSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if typ.Kind() == reflect.Ptr {
+		// an empty yaml value decodes into nil
+		return map[string]interface{}{
+			"anyOf": []interface{}{map[string]interface{}{"type": "null"}, typeSchema(typ.Elem(), defs)},
+		}
+	}
+	s := structuralSchema(typ, defs)
+	if scalar, ok := scalarForms[typ]; ok {
+		return map[string]interface{}{
+			"anyOf": []interface{}{map[string]interface{}{"type": scalar}, s},
+		}
+	}
+	return s
+}
+
+func structuralSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(typ.Elem(), defs)}
+	case reflect.Map:
+		values := typeSchema(typ.Elem(), defs)
+		if typ.Elem().Kind() == reflect.String {
+			// vars and env: yaml scalars of any kind decode into strings
+			values = map[string]interface{}{"type": []string{"string", "number", "boolean"}}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}
+	case reflect.Struct:
+		name := typ.Name()
+		if _, ok := defs[name]; !ok {
+			defs[name] = nil // placeholder, stops recursion on self-referencing types
+			defs[name] = structSchema(typ, defs)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes the yaml fields of a struct; unknown keys are not allowed, as in strict decoding
+func structSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for name, f := range yamlFields(typ) {
+		p := typeSchema(f.Type, defs)
+		if enum := f.Tag.Get("enum"); enum != "" {
+			p["enum"] = strings.Split(enum, ",")
+		}
+		props[name] = p
+		if !strings.Contains(f.Tag.Get("yaml"), ",omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
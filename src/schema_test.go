@@ -0,0 +1,23 @@
+package src
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// wrkit.schema.json is generated by `go run . -m schema > wrkit.schema.json`
+// and has to be regenerated whenever the config structs change
+func TestSchemaFileUpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile("../wrkit.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.ReplaceAll(file, []byte("\r\n"), []byte("\n")), buf.Bytes()) {
+		t.Error("wrkit.schema.json is out of date, run `go run . -m schema > wrkit.schema.json`")
+	}
+}
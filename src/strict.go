@@ -0,0 +1,177 @@
+package src
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem — single issue found in a config file. Position and task are optional.
+type Problem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Task    string `json:"task,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	msg := p.Message
+	if p.Task != "" {
+		msg = fmt.Sprintf("task %q: %s", p.Task, msg)
+	}
+	switch {
+	case p.File != "" && p.Line > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, msg)
+	case p.File != "":
+		return fmt.Sprintf("%s: %s", p.File, msg)
+	}
+	return msg
+}
+
+// withMessage returns a copy of p with a formatted message
+func (p Problem) withMessage(format string, args ...interface{}) Problem {
+	p.Message = fmt.Sprintf(format, args...)
+	return p
+}
+
+// unknownFields walks a YAML node against the Go type it is decoded into and
+// reports every mapping key that has no matching `yaml` field, with its
+// position and a suggestion. Scalars in place of structs are left to custom
+// unmarshalers (e.g. a plain string for Command).
+func unknownFields(file string, node *yaml.Node, typ reflect.Type) []error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var errs []error
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, c := range node.Content {
+			errs = append(errs, unknownFields(file, c, typ)...)
+		}
+		return errs
+	case yaml.AliasNode:
+		// anchors are checked where they are defined
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := yamlFields(typ)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if k.Value == "<<" {
+				continue // merge key
+			}
+			f, ok := fields[k.Value]
+			if !ok {
+				pos := Problem{File: file, Line: k.Line, Column: k.Column}
+				errs = append(errs, pos.withMessage("unknown field %q%s", k.Value, didYouMean(k.Value, names)))
+				continue
+			}
+			errs = append(errs, unknownFields(file, v, f.Type)...)
+		}
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				errs = append(errs, unknownFields(file, item, typ.Elem())...)
+			}
+		}
+	case reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				errs = append(errs, unknownFields(file, node.Content[i], typ.Elem())...)
+			}
+		}
+	}
+	return errs
+}
+
+// yamlFields maps yaml keys of a struct to its fields
+func yamlFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// didYouMean returns ` (did you mean "x"?)` for the closest candidate, or ""
+func didYouMean(name string, candidates []string) string {
+	if s := suggest(name, candidates); s != "" {
+		return fmt.Sprintf(" (did you mean %q?)", s)
+	}
+	return ""
+}
+
+// suggest returns the candidate closest to name by edit distance, if it is close enough
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := editDistance(name, c)
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	limit := len(name) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	if bestDist < 0 || bestDist > limit {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
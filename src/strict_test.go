@@ -0,0 +1,56 @@
+package src
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"build", "build", 0},
+		{"buld", "build", 1},
+		{"biuld", "build", 2},
+		{"kitten", "sitting", 3},
+		{"привет", "привед", 1}, // runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tasks := []string{"build", "build-all", "lint", "test"}
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"buld", tasks, "build"},
+		{"tset", tasks, "test"},
+		{"lnt", tasks, "lint"},
+		{"deploy", tasks, ""},              // too far from everything
+		{"x", tasks, ""},                   // limit is at least 2, "x" is 4 from "lint"
+		{"ab", []string{"xy", "cd"}, "xy"}, // a tie keeps the first candidate
+		{"build-al", tasks, "build-all"},
+		{"anything", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, tt.candidates); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got, want := didYouMean("buld", tasks), ` (did you mean "build"?)`; got != want {
+		t.Errorf("didYouMean = %q, want %q", got, want)
+	}
+	if got := didYouMean("deploy", tasks); got != "" {
+		t.Errorf("didYouMean without a close name = %q, want empty", got)
+	}
+}
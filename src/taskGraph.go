@@ -3,6 +3,8 @@ package src
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 type TaskNode struct {
@@ -17,6 +19,38 @@ type TaskGraph struct {
 }
 
 func BuildGraph(cfg *Config) (*TaskGraph, error) {
+	g := newGraph(cfg)
+	// Validate task settings
+	for name, n := range g.Nodes {
+		if err := n.Cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("task %q: %w", name, err)
+		}
+	}
+	// Validate deps presence
+	for _, name := range g.Names() {
+		for _, d := range g.Deps[name] {
+			if _, ok := g.Nodes[d]; !ok {
+				return nil, fmt.Errorf("task %q depends on unknown task %q%s", name, d, didYouMean(d, g.Names()))
+			}
+		}
+	}
+	// Validate post-tasks presence; templated names are known once rendered
+	for _, name := range g.Names() {
+		for _, p := range g.Nodes[name].Cfg.Post {
+			if _, ok := g.Nodes[p.Name]; !ok && !strings.Contains(p.Name, "{{") {
+				return nil, fmt.Errorf("task %q has post-task %q that is not a task%s", name, p.Name, didYouMean(p.Name, g.Names()))
+			}
+		}
+	}
+	// Check cycles
+	if err := checkCycles(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// newGraph builds nodes and dep edges of cfg without any validation
+func newGraph(cfg *Config) *TaskGraph {
 	g := &TaskGraph{
 		Nodes: map[string]*TaskNode{},
 		Deps:  map[string][]string{},
@@ -26,83 +60,166 @@ func BuildGraph(cfg *Config) (*TaskGraph, error) {
 			Name: name,
 			Cfg:  tcfg,
 		}
-		if tcfg.Deps == nil {
-			g.Deps[name] = []string{}
-		} else {
-			g.Deps[name] = append([]string(nil), tcfg.Deps...)
-		}
-	}
-	// Validate deps presence
-	for name, deps := range g.Deps {
-		for _, d := range deps {
-			if _, ok := g.Nodes[d]; !ok {
-				return nil, fmt.Errorf("task %q depends on unknown task %q", name, d)
+		// deps with vars are instances once resolveTaskNames ran; before
+		// that they count as deps on the task itself. Templated names of
+		// tasks it did not reach are known only for a run that needs them.
+		g.Deps[name] = make([]string, 0, len(tcfg.Deps))
+		for _, d := range tcfg.Deps {
+			if !strings.Contains(d.Task, "{{") {
+				g.Deps[name] = append(g.Deps[name], d.Task)
 			}
 		}
 	}
-	// Check cycles
-	if err := checkCycles(g); err != nil {
-		return nil, err
+	return g
+}
+
+// Names returns task names in sorted order
+func (g *TaskGraph) Names() []string {
+	names := make([]string, 0, len(g.Nodes))
+	for name := range g.Nodes {
+		names = append(names, name)
 	}
-	return g, nil
+	sort.Strings(names)
+	return names
 }
 
 func checkCycles(g *TaskGraph) error {
-	// DFS coloring
-	const (
-		gray  = 1
-		black = 2
-	)
-	color := make(map[string]int)
-	var stack []string
-	var visit func(string) error
-	visit = func(u string) error {
-		color[u] = gray
-		stack = append(stack, u)
-		for _, v := range g.Deps[u] {
-			if color[v] == 0 {
-				if err := visit(v); err != nil {
-					return err
+	if cycles := findCycles(g); len(cycles) > 0 {
+		return errors.New("cycle detected: " + fmt.Sprint(cycles[0]))
+	}
+	return nil
+}
+
+// maxCycles bounds the cycles findCycles reports: a dense graph can have
+// exponentially many
+const maxCycles = 1000
+
+// findCycles returns every elementary cycle of the graph (Johnson's
+// algorithm), each starting and ending at its smallest name, so the result is
+// stable. Deps that are not tasks are ignored.
+func findCycles(g *TaskGraph) [][]string {
+	names := g.Names()
+	var cycles [][]string
+	seen := map[string]bool{}
+	for _, start := range names {
+		// cycles through start that use only names >= start, so every
+		// cycle is found once, from its smallest name
+		allowed := func(n string) bool {
+			_, ok := g.Nodes[n]
+			return ok && n >= start
+		}
+		comp := g.componentOf(start, allowed)
+		blocked := map[string]bool{}
+		blockedBy := map[string]map[string]bool{}
+		var unblock func(string)
+		unblock = func(u string) {
+			blocked[u] = false
+			for w := range blockedBy[u] {
+				delete(blockedBy[u], w)
+				if blocked[w] {
+					unblock(w)
 				}
-			} else if color[v] == gray {
-				// found cycle
-				// build cycle description
-				cycle := append([]string{}, stack...)
-				cycle = append(cycle, v)
-				return errors.New("cycle detected: " + fmt.Sprint(cycle))
 			}
 		}
-		color[u] = black
-		stack = stack[:len(stack)-1]
-		return nil
+		var stack []string
+		var circuit func(string) bool
+		circuit = func(v string) bool {
+			found := false
+			stack = append(stack, v)
+			blocked[v] = true
+			for _, w := range g.Deps[v] {
+				if !comp[w] || len(cycles) >= maxCycles {
+					continue
+				}
+				if w == start {
+					cycle := append(append([]string(nil), stack...), start)
+					if key := fmt.Sprint(cycle); !seen[key] {
+						seen[key] = true
+						cycles = append(cycles, cycle)
+					}
+					found = true
+				} else if !blocked[w] && circuit(w) {
+					found = true
+				}
+			}
+			if found {
+				unblock(v)
+			} else {
+				for _, w := range g.Deps[v] {
+					if comp[w] {
+						if blockedBy[w] == nil {
+							blockedBy[w] = map[string]bool{}
+						}
+						blockedBy[w][v] = true
+					}
+				}
+			}
+			stack = stack[:len(stack)-1]
+			return found
+		}
+		circuit(start)
 	}
-	for name := range g.Nodes {
-		if color[name] == 0 {
-			if err := visit(name); err != nil {
-				return err
+	return cycles
+}
+
+// componentOf returns the strongly connected component of start in the
+// graph of allowed nodes: nodes reachable from start that also reach it
+func (g *TaskGraph) componentOf(start string, allowed func(string) bool) map[string]bool {
+	forward := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range g.Deps[u] {
+			if allowed(v) && !forward[v] {
+				forward[v] = true
+				queue = append(queue, v)
 			}
 		}
 	}
-	return nil
+	// backward: walk reversed edges inside forward
+	comp := map[string]bool{start: true}
+	for changed := true; changed; {
+		changed = false
+		for u := range forward {
+			if comp[u] {
+				continue
+			}
+			for _, v := range g.Deps[u] {
+				if comp[v] {
+					comp[u] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return comp
 }
 
-// CollectSubgraph returns all tasks needed for the named root (including root).
-func (g *TaskGraph) CollectSubgraph(root string) ([]string, error) {
-	if _, ok := g.Nodes[root]; !ok {
-		return nil, fmt.Errorf("task %q not found", root)
+// CollectSubgraph returns all tasks needed for the named roots (including roots).
+// Shared dependencies are listed once.
+func (g *TaskGraph) CollectSubgraph(roots ...string) ([]string, error) {
+	for _, root := range roots {
+		if _, ok := g.Nodes[root]; !ok {
+			return nil, fmt.Errorf("task %q not found%s", root, didYouMean(root, g.Names()))
+		}
 	}
-	// order is post-order: dependencies first, root last
-	return g.dfsCollect(root), nil
+	// order is post-order: dependencies first, root last; roots in given order
+	return g.dfsCollect(roots), nil
 }
 
 // dfsCollect - performs a dfs to collect task dependencies in post-order
-func (g *TaskGraph) dfsCollect(root string) []string {
+func (g *TaskGraph) dfsCollect(roots []string) []string {
 	type frame struct {
 		node     string
 		expanded bool // false = first visit, true = after children
 	}
 
-	stack := []frame{{node: root}}
+	stack := make([]frame, 0, len(roots))
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, frame{node: roots[i]})
+	}
 	visited := map[string]bool{}
 	var order []string
 
@@ -129,25 +246,27 @@ func (g *TaskGraph) dfsCollect(root string) []string {
 	return order
 }
 
+// WavesFor splits the subgraph of root into waves: every task of a wave
+// depends only on tasks of earlier waves
 func (g *TaskGraph) WavesFor(root string) ([][]string, error) {
 	order, err := g.CollectSubgraph(root)
 	if err != nil {
 		return nil, err
 	}
+	return g.Waves(order), nil
+}
 
-	indeg := map[string]int{}
-	for k := range g.Nodes {
-		indeg[k] = len(g.Deps[k])
-	}
-
-	var waves [][]string
+// Waves splits the given tasks into waves; deps outside of tasks are ignored.
+// Names inside a wave are sorted.
+func (g *TaskGraph) Waves(tasks []string) [][]string {
 	subset := map[string]bool{}
-	for _, n := range order {
+	for _, n := range tasks {
 		subset[n] = true
 	}
 
+	var waves [][]string
 	done := map[string]bool{}
-	for {
+	for len(done) < len(subset) {
 		var ready []string
 		for n := range subset {
 			if done[n] {
@@ -165,12 +284,13 @@ func (g *TaskGraph) WavesFor(root string) ([][]string, error) {
 			}
 		}
 		if len(ready) == 0 {
-			break
+			break // cycle, BuildGraph does not let it through
 		}
+		sort.Strings(ready)
 		waves = append(waves, ready)
 		for _, r := range ready {
 			done[r] = true
 		}
 	}
-	return waves, nil
+	return waves
 }
@@ -0,0 +1,119 @@
+package src
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// depsGraph builds a graph from deps by task without checking for cycles
+func depsGraph(deps map[string][]string) *TaskGraph {
+	cfg := &Config{Tasks: map[string]*TaskConfig{}}
+	for name, list := range deps {
+		tc := &TaskConfig{}
+		for _, d := range list {
+			tc.Deps = append(tc.Deps, TaskDep{Task: d})
+		}
+		cfg.Tasks[name] = tc
+	}
+	return newGraph(cfg)
+}
+
+func TestFindCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{"no cycles", map[string][]string{"a": {"b", "c"}, "b": {"c"}, "c": nil}, nil},
+		{"self-loop", map[string][]string{"a": {"a"}, "b": {"a"}}, []string{"a -> a"}},
+		{"two tasks", map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"a -> b -> a"}},
+		{"starts at the smallest name", map[string][]string{"c": {"a"}, "a": {"b"}, "b": {"c"}}, []string{"a -> b -> c -> a"}},
+		{
+			"two cycles through one task",
+			map[string][]string{"x": {"a", "b"}, "a": {"x"}, "b": {"x"}},
+			[]string{"a -> x -> a", "b -> x -> b"},
+		},
+		{
+			"self-loop inside a cycle",
+			map[string][]string{"a": {"a", "b"}, "b": {"a"}},
+			[]string{"a -> a", "a -> b -> a"},
+		},
+		{
+			"every cycle of a dense component",
+			map[string][]string{"a": {"b", "c"}, "b": {"a", "c"}, "c": {"a", "b"}},
+			[]string{"a -> b -> a", "a -> b -> c -> a", "a -> c -> a", "a -> c -> b -> a", "b -> c -> b"},
+		},
+		{
+			"separate components",
+			map[string][]string{"a": {"b"}, "b": {"a"}, "c": {"d"}, "d": {"c"}, "e": {"a", "c"}},
+			[]string{"a -> b -> a", "c -> d -> c"},
+		},
+		{"deps that are not tasks", map[string][]string{"a": {"missing", "b"}, "b": {"a"}}, []string{"a -> b -> a"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range findCycles(depsGraph(tt.deps)) {
+				got = append(got, strings.Join(c, " -> "))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cycles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCyclesLimit(t *testing.T) {
+	// every task depends on every other one: 7 tasks have 2365 elementary cycles
+	deps := map[string][]string{}
+	for i := 0; i < 7; i++ {
+		for j := 0; j < 7; j++ {
+			if i != j {
+				deps[fmt.Sprint(i)] = append(deps[fmt.Sprint(i)], fmt.Sprint(j))
+			}
+		}
+	}
+	cycles := findCycles(depsGraph(deps))
+	if len(cycles) != maxCycles {
+		t.Fatalf("found %d cycles, want the limit %d", len(cycles), maxCycles)
+	}
+	seen := map[string]bool{}
+	for _, c := range cycles {
+		key := strings.Join(c, " ")
+		if seen[key] {
+			t.Errorf("cycle %s reported twice", key)
+		}
+		seen[key] = true
+		if c[0] != c[len(c)-1] {
+			t.Errorf("cycle %s does not end where it starts", key)
+		}
+	}
+}
+
+func TestComponentOf(t *testing.T) {
+	g := depsGraph(map[string][]string{
+		"a": {"b"}, "b": {"c", "d"}, "c": {"a"}, "d": {"e"}, "e": {"d"},
+	})
+	all := func(string) bool { return true }
+	tests := []struct {
+		start   string
+		allowed func(string) bool
+		want    []string
+	}{
+		{"a", all, []string{"a", "b", "c"}},
+		{"d", all, []string{"d", "e"}},
+		{"a", func(n string) bool { return n != "c" }, []string{"a"}},
+		{"b", func(n string) bool { return n >= "b" }, []string{"b"}},
+	}
+	for _, tt := range tests {
+		got := sortedKeys(g.componentOf(tt.start, tt.allowed))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("componentOf(%s) = %q, want %q", tt.start, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package src
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// listEntry — task as printed by `list --json`
+type listEntry struct {
+	Name     string   `json:"name"`
+	Desc     string   `json:"desc,omitempty"`
+	Origin   string   `json:"origin"` // local, master
+	File     string   `json:"file,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Deps     []string `json:"deps,omitempty"`
+	Parallel bool     `json:"parallel"`
+}
+
+func newListEntry(name string, t *TaskConfig) listEntry {
+	return listEntry{
+		Name:     name,
+		Desc:     t.Desc,
+		Origin:   t.origin,
+		File:     t.file,
+		Tags:     t.Tags,
+		Deps:     depNames(t.Deps),
+		Parallel: t.Parallel,
+	}
+}
+
+// filterTasks returns sorted names of tasks matching any of the name globs
+// and having any of the tags; empty patterns or tags match everything
+func filterTasks(cfg *Config, patterns, tags []string) ([]string, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+	var out []string
+	for _, name := range cfg.TaskNames() {
+		t := cfg.Tasks[name]
+		if matchesAny(name, patterns) && hasAnyTag(t, tags) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyTag(t *TaskConfig, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, want := range tags {
+		for _, tag := range t.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printTaskLine prints name, origin, desc and tags aligned to nameWidth
+func printTaskLine(name string, t *TaskConfig, nameWidth int) {
+	desc := t.Desc
+	if desc == "" {
+		desc = "-"
+	}
+	if len(t.Tags) > 0 {
+		desc += " [" + strings.Join(t.Tags, ", ") + "]"
+	}
+	fmt.Printf("%-*s %-6s %s\n", nameWidth, name, t.origin, desc)
+}
+
+// printDepTree prints deps of task name below it, indented with tree guides.
+// A dep already on the current path is a cycle and is not expanded.
+func printDepTree(cfg *Config, name, indent string, onPath map[string]bool) {
+	onPath[name] = true
+	defer delete(onPath, name)
+	deps := depNames(cfg.Tasks[name].Deps)
+	for i, d := range deps {
+		branch, next := "├── ", "│   "
+		if i == len(deps)-1 {
+			branch, next = "└── ", "    "
+		}
+		switch _, ok := cfg.Tasks[d]; {
+		case !ok:
+			fmt.Printf("%s%s%s (unknown task)\n", indent, branch, d)
+		case onPath[d]:
+			fmt.Printf("%s%s%s (cycle)\n", indent, branch, d)
+		default:
+			fmt.Printf("%s%s%s\n", indent, branch, d)
+			printDepTree(cfg, d, indent+next, onPath)
+		}
+	}
+}
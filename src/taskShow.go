@@ -0,0 +1,314 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// taskView — task as printed by `show`. With resolved set, templates are
+// rendered and dir/env are what the commands will actually get.
+type taskView struct {
+	Name          string               `json:"name"`
+	Desc          string               `json:"desc,omitempty"`
+	File          string               `json:"file,omitempty"`
+	Origin        string               `json:"origin"`
+	Resolved      bool                 `json:"resolved"`
+	Dir           string               `json:"dir,omitempty"`
+	Deps          []string             `json:"deps,omitempty"`
+	RunOrder      []string             `json:"run_order"` // transitive deps in execution order, the task itself last
+	Tags          []string             `json:"tags,omitempty"`
+	Cmds          []commandView        `json:"cmds,omitempty"`
+	Args          []TaskArg            `json:"args,omitempty"`
+	Vars          map[string]Var       `json:"vars,omitempty"` // set by the task
+	If            string               `json:"if,omitempty"`
+	Preconditions []Precondition       `json:"preconditions,omitempty"`
+	Env           map[string]string    `json:"env,omitempty"`         // set by the task
+	ProcessEnv    map[string]string    `json:"process_env,omitempty"` // resolved only: inherited + task env
+	Post          []postView           `json:"post,omitempty"`
+	Parallel      bool                 `json:"parallel"`
+	Output        string               `json:"output,omitempty"`
+	Outputs       map[string]OutputVar `json:"outputs,omitempty"`
+	Timeout       string               `json:"timeout,omitempty"`
+	Retry         *retryView           `json:"retry,omitempty"`
+}
+
+type commandView struct {
+	Cmd     string `json:"cmd"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type postView struct {
+	Name string `json:"name"`
+	When string `json:"when"` // success, fail, always
+}
+
+type retryView struct {
+	Attempts  int    `json:"attempts"`
+	Delay     string `json:"delay"`
+	Backoff   string `json:"backoff"`
+	MaxDelay  string `json:"max_delay,omitempty"`
+	ExitCodes []int  `json:"exit_codes,omitempty"`
+	Scope     string `json:"scope"`
+}
+
+// newTaskView describes task name. When resolved, templates are rendered with
+// the run's vars: --var values, positional values of declared args and cliArgs.
+func newTaskView(cfg *Config, name string, resolved bool, positional, cliArgs []string, cliVars map[string]string) (*taskView, error) {
+	t, ok := cfg.Tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("task %q not found%s", name, didYouMean(name, cfg.TaskNames()))
+	}
+	// same vars as a run of this task would get
+	overrides := map[string]string{"CLI_ARGS": shellJoin(cliArgs)}
+	for k, val := range cliVars {
+		overrides[k] = val
+	}
+	scope := newVarScope(cfg, overrides)
+	var roots []string
+	node := name // graph node of the task, an instance with positional values
+	if resolved {
+		var err error
+		if cfg, roots, err = callInstances(cfg, []TaskCall{{Name: name, Args: positional}}, cliVars); err != nil {
+			return nil, err
+		}
+		node = roots[0]
+		// as in a run: sh vars are evaluated, only for what the task needs
+		scope.dyn = newDynamicVars(context.Background(), 0)
+	}
+	graphCfg, err := resolveTaskNames(cfg, scope, roots)
+	if err != nil {
+		return nil, err
+	}
+	g, err := BuildGraph(graphCfg)
+	if err != nil {
+		return nil, err
+	}
+	order, err := g.CollectSubgraph(node)
+	if err != nil {
+		return nil, err
+	}
+	v := &taskView{
+		Name:          name,
+		Desc:          t.Desc,
+		File:          t.file,
+		Origin:        t.origin,
+		Resolved:      resolved,
+		Dir:           t.Dir,
+		Deps:          depNames(t.Deps),
+		RunOrder:      order,
+		Tags:          t.Tags,
+		Args:          t.Args,
+		Vars:          t.Vars,
+		If:            t.If,
+		Preconditions: t.Preconditions,
+		Env:           t.Env,
+		Parallel:      t.Parallel,
+		Outputs:       t.Outputs,
+	}
+	if t.Output != nil {
+		v.Output = t.Output.Mode
+	}
+	for _, c := range t.Cmds {
+		v.Cmds = append(v.Cmds, commandView{Cmd: c.Cmd, Timeout: durationString(c.Timeout)})
+	}
+	for _, p := range t.Post {
+		v.Post = append(v.Post, postView{Name: p.Name, When: normalizeWhen(p.When)})
+	}
+	v.Timeout = durationString(t.Timeout)
+	if r := t.Retry; r != nil {
+		v.Retry = &retryView{
+			Attempts:  r.Attempts,
+			Delay:     r.Delay.String(),
+			Backoff:   orDefault(r.Backoff, "fixed"),
+			MaxDelay:  durationString(r.MaxDelay),
+			ExitCodes: r.ExitCodes,
+			Scope:     orDefault(r.Scope, "task"),
+		}
+	}
+	if !resolved {
+		return v, nil
+	}
+
+	t = cfg.Tasks[node]
+	vars, err := scope.forTask(t)
+	if err != nil {
+		return nil, err
+	}
+	v.Deps = depNames(graphCfg.Tasks[node].Deps)
+	for i, p := range graphCfg.Tasks[node].Post {
+		v.Post[i].Name = p.Name
+	}
+
+	for i := range v.Cmds {
+		if v.Cmds[i].Cmd, err = renderTemplate(v.Cmds[i].Cmd, vars); err != nil {
+			return nil, err
+		}
+	}
+	if v.If, err = renderTemplate(v.If, vars); err != nil {
+		return nil, err
+	}
+	v.Preconditions = append([]Precondition(nil), t.Preconditions...)
+	for i := range v.Preconditions {
+		if v.Preconditions[i].Sh, err = renderTemplate(v.Preconditions[i].Sh, vars); err != nil {
+			return nil, err
+		}
+	}
+	rt, err := resolveTask(t, scope)
+	if err != nil {
+		return nil, err
+	}
+	v.Env = rt.Env
+	cmd := shellCommand(rt, "")
+	v.Dir = cmd.Dir
+	v.ProcessEnv = map[string]string{}
+	for _, kv := range cmd.Env {
+		if k, val, ok := strings.Cut(kv, "="); ok {
+			v.ProcessEnv[k] = val
+		}
+	}
+	return v, nil
+}
+
+// durationString formats d, zero is ""
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// printTaskView prints v in the `key: value` form of show
+func printTaskView(v *taskView) {
+	fmt.Printf("name: %s\n", v.Name)
+	fmt.Printf("desc: %s\n", v.Desc)
+	if v.File != "" {
+		fmt.Printf("file: %s (%s)\n", v.File, v.Origin)
+	}
+	fmt.Printf("dir:  %s\n", v.Dir)
+	if len(v.Deps) > 0 {
+		fmt.Printf("deps: %s\n", strings.Join(v.Deps, ", "))
+	}
+	if len(v.RunOrder) > 1 {
+		fmt.Printf("run order: %s\n", strings.Join(v.RunOrder, " → "))
+	}
+	if len(v.Tags) > 0 {
+		fmt.Printf("tags: %s\n", strings.Join(v.Tags, ", "))
+	}
+	if len(v.Cmds) > 0 {
+		fmt.Println("cmds:")
+		for _, c := range v.Cmds {
+			if c.Timeout != "" {
+				fmt.Printf("  - %s (timeout %s)\n", c.Cmd, c.Timeout)
+			} else {
+				fmt.Printf("  - %s\n", c.Cmd)
+			}
+		}
+	}
+	if len(v.Args) > 0 {
+		fmt.Println("args:")
+		for _, a := range v.Args {
+			fmt.Printf("  - %s", a.Name)
+			switch {
+			case a.Required:
+				fmt.Print(" (required)")
+			case a.Default != "":
+				fmt.Printf(" (default %q)", a.Default)
+			}
+			if a.Desc != "" {
+				fmt.Printf(" — %s", a.Desc)
+			}
+			fmt.Println()
+		}
+	}
+	if len(v.Vars) > 0 {
+		fmt.Println("vars:")
+		names := make([]string, 0, len(v.Vars))
+		for name := range v.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sh := v.Vars[name].Sh; sh != "" {
+				fmt.Printf("  %s: sh %s\n", name, sh)
+			} else {
+				fmt.Printf("  %s: %s\n", name, v.Vars[name].Value)
+			}
+		}
+	}
+	if v.If != "" {
+		fmt.Printf("if: %s\n", v.If)
+	}
+	if len(v.Preconditions) > 0 {
+		fmt.Println("preconditions:")
+		for _, p := range v.Preconditions {
+			fmt.Printf("  - %s (on_fail=%s)", p.Sh, orDefault(p.OnFail, "fail"))
+			if p.Msg != "" {
+				fmt.Printf(" — %s", p.Msg)
+			}
+			fmt.Println()
+		}
+	}
+	if len(v.Env) > 0 || v.Resolved {
+		fmt.Println("env:")
+		keys := make([]string, 0, len(v.Env))
+		for k := range v.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  %s=%s\n", k, v.Env[k])
+		}
+		if v.Resolved {
+			inherited := 0
+			for k := range v.ProcessEnv {
+				if _, set := v.Env[k]; !set {
+					inherited++
+				}
+			}
+			fmt.Printf("  (+ %d inherited from the environment)\n", inherited)
+		}
+	}
+	if len(v.Post) > 0 {
+		fmt.Println("post:")
+		for _, p := range v.Post {
+			fmt.Printf("  - %s (when=%s)\n", p.Name, p.When)
+		}
+	}
+	fmt.Printf("parallel: %v\n", v.Parallel)
+	if v.Output != "" {
+		fmt.Printf("output: %s\n", v.Output)
+	}
+	if len(v.Outputs) > 0 {
+		fmt.Println("outputs:")
+		names := make([]string, 0, len(v.Outputs))
+		for name := range v.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			o := v.Outputs[name]
+			switch {
+			case o.Sh != "":
+				fmt.Printf("  %s: sh %s\n", name, o.Sh)
+			default:
+				fmt.Printf("  %s: %s from %s\n", name, orDefault(o.Key, name), o.File)
+			}
+		}
+	}
+	if v.Timeout != "" {
+		fmt.Printf("timeout: %s\n", v.Timeout)
+	}
+	if r := v.Retry; r != nil {
+		fmt.Printf("retry: attempts=%d delay=%s backoff=%s", r.Attempts, r.Delay, r.Backoff)
+		if r.MaxDelay != "" {
+			fmt.Printf(" max_delay=%s", r.MaxDelay)
+		}
+		if len(r.ExitCodes) > 0 {
+			fmt.Printf(" exit_codes=%v", r.ExitCodes)
+		}
+		fmt.Printf(" scope=%s\n", r.Scope)
+	}
+}
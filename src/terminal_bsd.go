@@ -0,0 +1,7 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package src
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TIOCGETA
@@ -0,0 +1,5 @@
+package src
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
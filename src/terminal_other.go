@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package src
+
+// isTerminal is not known here; commands then always get stdin
+func isTerminal(_ int) bool {
+	return false
+}
+
+// foregroundTerminal: no job control, commands never get the terminal
+func foregroundTerminal() (int, bool) {
+	return 0, false
+}
+
+func takeTerminal(_ int) {}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package src
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether fd is a terminal; /dev/null and pipes are not
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlReadTermios, uintptr(unsafe.Pointer(&t)))
+	return errno == 0
+}
+
+// foregroundTerminal returns the fd of the terminal on stdin if wrkit is in
+// its foreground process group, i.e. runs interactively and not as `wrkit &`
+func foregroundTerminal() (int, bool) {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return 0, false
+	}
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	return fd, errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
+
+// takeTerminal makes wrkit's process group the foreground one of the
+// terminal fd again, after a command had it
+func takeTerminal(fd int) {
+	// a background group changing the foreground one gets SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	pgrp := int32(syscall.Getpgrp())
+	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pgrp)))
+}
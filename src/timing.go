@@ -0,0 +1,250 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runTimer records when tasks and commands of a run start and end,
+// for the timing table, the critical path and the trace file
+type runTimer struct {
+	mu    sync.Mutex
+	start time.Time
+	tasks []*taskSpan
+	cmds  []*cmdSpan
+}
+
+// taskSpan — one execution of a task; a task that is also a post-task has two
+type taskSpan struct {
+	Name, Kind string
+	Parallel   bool
+	Start, End time.Time
+	Status     string
+	Err        error
+}
+
+type cmdSpan struct {
+	Task, Kind, Cmd string
+	Start, End      time.Time
+	Err             error
+}
+
+func newRunTimer() *runTimer {
+	return &runTimer{start: time.Now()}
+}
+
+// startTask records the start of a task; finishTask records its end
+func (r *runTimer) startTask(name, kind string, parallel bool) *taskSpan {
+	s := &taskSpan{Name: name, Kind: kind, Parallel: parallel, Start: time.Now()}
+	r.mu.Lock()
+	r.tasks = append(r.tasks, s)
+	r.mu.Unlock()
+	return s
+}
+
+func (r *runTimer) finishTask(s *taskSpan, status string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.End, s.Status, s.Err = time.Now(), status, err
+}
+
+func (r *runTimer) startCommand(task, kind, cmd string) *cmdSpan {
+	s := &cmdSpan{Task: task, Kind: kind, Cmd: cmd, Start: time.Now()}
+	r.mu.Lock()
+	r.cmds = append(r.cmds, s)
+	r.mu.Unlock()
+	return s
+}
+
+func (r *runTimer) finishCommand(s *cmdSpan, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.End, s.Err = time.Now(), err
+}
+
+// criticalPath returns the chain of deps with the longest total wall time
+// among the tasks of subgraph that ran, and that time
+func (r *runTimer) criticalPath(g *TaskGraph, subgraph []string) ([]string, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	took := map[string]time.Duration{}
+	for _, s := range r.tasks {
+		if strings.HasPrefix(s.Kind, "post-task") || s.End.IsZero() {
+			continue
+		}
+		took[s.Name] = s.End.Sub(s.Start)
+	}
+	// subgraph is in post-order, deps are always done before their dependents
+	total := map[string]time.Duration{}
+	prev := map[string]string{}
+	best := ""
+	for _, name := range subgraph {
+		d, ran := took[name]
+		if !ran {
+			continue
+		}
+		longest := time.Duration(0)
+		for _, dep := range g.Deps[name] {
+			if t, ok := total[dep]; ok && t > longest {
+				longest, prev[name] = t, dep
+			}
+		}
+		total[name] = longest + d
+		if best == "" || total[name] > total[best] {
+			best = name
+		}
+	}
+	if best == "" {
+		return nil, 0
+	}
+	var path []string
+	for n := best; n != ""; n = prev[n] {
+		path = append([]string{n}, path...)
+	}
+	return path, total[best]
+}
+
+// printTimings prints every task run in start order with its wall time,
+// mode and result, and the critical path; its tasks are marked with *
+func (r *runTimer) printTimings(g *TaskGraph, subgraph []string, opts RunOptions) {
+	path, pathTime := r.criticalPath(g, subgraph)
+	onPath := map[string]bool{}
+	for _, name := range path {
+		onPath[name] = true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := append([]*taskSpan(nil), r.tasks...)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+
+	nameWidth := 4
+	for _, s := range spans {
+		if len(s.Name) > nameWidth {
+			nameWidth = len(s.Name)
+		}
+	}
+	opts.printf("\ntimings:\n")
+	opts.printf("    %-*s %10s  %-4s %-16s %s\n", nameWidth, "task", "time", "mode", "kind", "result")
+	for _, s := range spans {
+		mark := " "
+		if onPath[s.Name] && !strings.HasPrefix(s.Kind, "post-task") {
+			mark = "*"
+		}
+		mode := "seq"
+		if s.Parallel {
+			mode = "par"
+		}
+		opts.printf("  %s %-*s %10s  %-4s %-16s %s\n", mark, nameWidth, s.Name, roundDuration(s.End.Sub(s.Start)), mode, s.Kind, s.Status)
+	}
+	opts.printf("  total %s", roundDuration(time.Since(r.start)))
+	if len(path) > 0 {
+		opts.printf(", critical path %s: %s", roundDuration(pathTime), strings.Join(path, " → "))
+	}
+	opts.printf("\n")
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d.Round(time.Millisecond)
+}
+
+// traceEvent — Chrome trace-event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"` // microseconds since the run start
+	Dur  int64                  `json:"dur"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// writeTrace writes the run as a Chrome trace (Perfetto, chrome://tracing).
+// Tasks running at the same time get separate lanes, commands are nested in their task.
+func (r *runTimer) writeTrace(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := append([]*taskSpan(nil), r.tasks...)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+
+	us := func(t time.Time) int64 { return t.Sub(r.start).Microseconds() }
+	var events []traceEvent
+	var laneFree []time.Time // end of the last span in every lane
+	laneOf := map[string][]*taskSpan{}
+	tidOf := map[*taskSpan]int{}
+	for _, s := range spans {
+		end := s.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		lane := -1
+		for i, free := range laneFree {
+			if !free.After(s.Start) {
+				lane = i
+				break
+			}
+		}
+		if lane < 0 {
+			lane = len(laneFree)
+			laneFree = append(laneFree, time.Time{})
+			events = append(events, traceEvent{
+				Name: "thread_name", Ph: "M", Pid: 1, Tid: lane + 1,
+				Args: map[string]interface{}{"name": fmt.Sprintf("slot %d", lane+1)},
+			})
+		}
+		laneFree[lane] = end
+		tidOf[s] = lane + 1
+		laneOf[s.Kind+"\x00"+s.Name] = append(laneOf[s.Kind+"\x00"+s.Name], s)
+
+		args := map[string]interface{}{"kind": s.Kind, "status": s.Status, "parallel": s.Parallel}
+		if s.Err != nil {
+			args["error"] = s.Err.Error()
+		}
+		events = append(events, traceEvent{
+			Name: s.Name, Cat: "task", Ph: "X", Ts: us(s.Start), Dur: end.Sub(s.Start).Microseconds(),
+			Pid: 1, Tid: lane + 1, Args: args,
+		})
+	}
+	for _, c := range r.cmds {
+		// the command belongs to the run of its task that contains it
+		tid := 0
+		for _, s := range laneOf[c.Kind+"\x00"+c.Task] {
+			if !c.Start.Before(s.Start) && (s.End.IsZero() || !c.Start.After(s.End)) {
+				tid = tidOf[s]
+			}
+		}
+		end := c.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		args := map[string]interface{}{"task": c.Task}
+		if c.Err != nil {
+			args["error"] = c.Err.Error()
+		}
+		if code := exitCode(c.Err); code != nil {
+			args["exit_code"] = *code
+		}
+		events = append(events, traceEvent{
+			Name: c.Cmd, Cat: "command", Ph: "X", Ts: us(c.Start), Dur: end.Sub(c.Start).Microseconds(),
+			Pid: 1, Tid: tid, Args: args,
+		})
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
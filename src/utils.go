@@ -3,6 +3,7 @@ package src
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -14,13 +15,50 @@ func renderTemplate(tmpl string, vars map[string]string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("bad template %q: %w", tmpl, err)
 	}
+	data := templateData(vars)
+	// an undefined var is "", as it was when the data was map[string]string
+	for _, name := range templateVars(tpl.Tree.Root) {
+		if _, ok := data[name]; !ok {
+			data[name] = ""
+		}
+	}
 	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, vars); err != nil {
+	if err := tpl.Execute(&buf, data); err != nil {
 		return "", fmt.Errorf("render template %q: %w", tmpl, err)
 	}
 	return buf.String(), nil
 }
 
+// templateData exposes `env.NAME` vars also as {{.env.NAME}} and outputs
+// `deps.TASK.NAME` as {{.deps.TASK.NAME}}; the maps are typed, so a missing
+// entry renders as "". A plain var called env or deps wins.
+func templateData(vars map[string]string) map[string]interface{} {
+	data := make(map[string]interface{}, len(vars)+2)
+	env := map[string]string{}
+	deps := map[string]map[string]string{}
+	for k, v := range vars {
+		data[k] = v
+		if name, ok := strings.CutPrefix(k, "env."); ok {
+			env[name] = v
+		} else if rest, ok := strings.CutPrefix(k, "deps."); ok {
+			if i := strings.LastIndex(rest, "."); i > 0 {
+				task := rest[:i]
+				if deps[task] == nil {
+					deps[task] = map[string]string{}
+				}
+				deps[task][rest[i+1:]] = v
+			}
+		}
+	}
+	if _, taken := data["env"]; !taken {
+		data["env"] = env
+	}
+	if _, taken := data["deps"]; !taken {
+		data["deps"] = deps
+	}
+	return data
+}
+
 func parseVars(slice []string) map[string]string {
 	out := map[string]string{}
 	for _, s := range slice {
@@ -50,3 +88,74 @@ func getTaskNameCompletions(toComplete string) ([]string, cobra.ShellCompDirecti
 	}
 	return completions, cobra.ShellCompDirectiveNoFileComp
 }
+
+// parseTaskCalls splits positional command line args into task calls and
+// everything after `--`. Values fill the declared args of the previous task
+// in order; a task name ends its optional args, a required one takes it as
+// a value. Any other value starts a new call, so an unknown task name is
+// reported as such.
+func parseTaskCalls(cfg *Config, cmd *cobra.Command, args []string) ([]TaskCall, []string, error) {
+	before, after := args, []string(nil)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		before, after = args[:dash], args[dash:]
+	}
+	var calls []TaskCall
+	for _, a := range before {
+		if n := len(calls); n > 0 {
+			last := &calls[n-1]
+			if t, ok := cfg.Tasks[last.Name]; ok && len(last.Args) < len(t.Args) {
+				_, isTask := cfg.Tasks[a]
+				if !isTask || t.Args[len(last.Args)].Required {
+					last.Args = append(last.Args, a)
+					continue
+				}
+			}
+		}
+		calls = append(calls, TaskCall{Name: a})
+	}
+	if len(calls) == 0 {
+		return nil, nil, fmt.Errorf("task name required")
+	}
+	return calls, after, nil
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellJoin quotes args for `sh -c` where needed and joins them with spaces
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		if shellSafe.MatchString(a) {
+			quoted = append(quoted, a)
+		} else {
+			quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runOptions collects run-related CLI flags into RunOptions
+func runOptions() RunOptions {
+	return RunOptions{
+		DryRun:      dryRun,
+		Verbose:     verbose,
+		Concurrency: concurrency,
+		KeepGoing:   keepGoing,
+		Force:       force,
+		GracePeriod: gracePeriod,
+		Timeout:     runTimeout,
+		Vars:        parseVars(varsSlice),
+		Output:      outputMode,
+		Format:      runFormat,
+		Timings:     timings,
+		Trace:       traceFile,
+	}
+}
+
+// orDefault returns def if s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
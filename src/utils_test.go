@@ -0,0 +1,98 @@
+package src
+
+import (
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-run", "TestFoo", "./pkg/..."}, "-run TestFoo ./pkg/..."},
+		{[]string{"-count=1", "user@host:/tmp/a,b+c%"}, "-count=1 user@host:/tmp/a,b+c%"},
+		{[]string{"two words"}, "'two words'"},
+		{[]string{""}, "''"},
+		{[]string{"it's"}, `'it'\''s'`},
+		{[]string{"$HOME", "a;b", "*.go"}, `'$HOME' 'a;b' '*.go'`},
+	}
+	for _, tt := range tests {
+		if got := shellJoin(tt.args); got != tt.want {
+			t.Errorf("shellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+// shell words of shellJoin's result are the original args
+func TestShellJoinRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	args := []string{"plain", "two words", "", "it's", `"quoted"`, "$HOME", "a;b|c", "*.go", "back\\slash", "line\nbreak"}
+	out, err := exec.Command("sh", "-c", `for a in `+shellJoin(args)+`; do printf '%s\000' "$a"; done`).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("sh saw %q, want %q", got, args)
+	}
+}
+
+func TestParseTaskCalls(t *testing.T) {
+	cfg := &Config{Tasks: map[string]*TaskConfig{
+		"greet": {Args: []TaskArg{{Name: "WHO"}}},
+		"copy":  {Args: []TaskArg{{Name: "FROM"}, {Name: "TO"}}},
+		"run":   {Args: []TaskArg{{Name: "TASK", Required: true}, {Name: "MODE"}}},
+		"lint":  {},
+		"build": {},
+	}}
+	tests := []struct {
+		name      string
+		args      []string
+		wantCalls []TaskCall
+		wantAfter []string
+	}{
+		{"one task", []string{"lint"}, []TaskCall{{Name: "lint"}}, nil},
+		{"several tasks", []string{"lint", "build"}, []TaskCall{{Name: "lint"}, {Name: "build"}}, nil},
+		{"arg value", []string{"greet", "bob", "lint"}, []TaskCall{{Name: "greet", Args: []string{"bob"}}, {Name: "lint"}}, nil},
+		{"a task name ends optional args", []string{"greet", "lint"}, []TaskCall{{Name: "greet"}, {Name: "lint"}}, nil},
+		{"a task name after a value", []string{"copy", "a", "lint"}, []TaskCall{{Name: "copy", Args: []string{"a"}}, {Name: "lint"}}, nil},
+		{"a required arg takes a task name", []string{"run", "lint", "build"}, []TaskCall{{Name: "run", Args: []string{"lint"}}, {Name: "build"}}, nil},
+		{"optional arg after a required one", []string{"run", "lint", "fast", "build"}, []TaskCall{{Name: "run", Args: []string{"lint", "fast"}}, {Name: "build"}}, nil},
+		{"args are filled in order", []string{"copy", "a", "b", "build"}, []TaskCall{{Name: "copy", Args: []string{"a", "b"}}, {Name: "build"}}, nil},
+		{"surplus value is a task", []string{"lint", "buld"}, []TaskCall{{Name: "lint"}, {Name: "buld"}}, nil},
+		{"unknown first task", []string{"nope", "x"}, []TaskCall{{Name: "nope"}, {Name: "x"}}, nil},
+		{"after dash", []string{"greet", "--", "-v", "lint"}, []TaskCall{{Name: "greet"}}, []string{"-v", "lint"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			calls, after, err := parseTaskCalls(cfg, cmd, cmd.Flags().Args())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %+v, want %+v", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(after, tt.wantAfter) {
+				t.Errorf("after -- = %q, want %q", after, tt.wantAfter)
+			}
+		})
+	}
+
+	if _, _, err := parseTaskCalls(cfg, &cobra.Command{}, nil); err == nil {
+		t.Error("no args: want an error")
+	}
+}
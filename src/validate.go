@@ -0,0 +1,288 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ValidateConfig statically checks cfg and returns every problem found:
+// load-time problems, bad task settings, unknown deps, all dependency
+// cycles, post-tasks, templates and task dirs. cliVars are --var values,
+// they count as defined variables.
+func ValidateConfig(cfg *Config, cliVars map[string]string) []Problem {
+	var problems []Problem
+	for _, err := range cfg.problems {
+		problems = append(problems, asProblem(err))
+	}
+
+	g := newGraph(cfg)
+	names := g.Names()
+	overrides := map[string]string{"CLI_ARGS": ""}
+	for k, v := range cliVars {
+		overrides[k] = v
+	}
+	scope := newVarScope(cfg, overrides)
+	for _, name := range names {
+		t := cfg.Tasks[name]
+		pos := Problem{File: t.file, Task: name}
+		if err := t.Validate(); err != nil {
+			problems = append(problems, pos.withMessage("%v", err))
+		}
+		for _, d := range t.Deps {
+			if strings.Contains(d.Task, "{{") {
+				continue // known only for a run
+			}
+			if _, ok := cfg.Tasks[d.Task]; !ok {
+				problems = append(problems, pos.withMessage("depends on unknown task %q%s", d.Task, didYouMean(d.Task, names)))
+			}
+		}
+		if templateProblems := checkTaskTemplates(cfg, name, t, cliVars); len(templateProblems) > 0 {
+			problems = append(problems, templateProblems...)
+		} else {
+			problems = append(problems, checkTemplatedNames(cfg, scope, name, t)...)
+		}
+		if t.Dir != "" && !strings.Contains(t.Dir, "{{") {
+			if info, err := os.Stat(t.WorkDir()); err != nil {
+				problems = append(problems, pos.withMessage("dir %q does not exist", t.WorkDir()))
+			} else if !info.IsDir() {
+				problems = append(problems, pos.withMessage("dir %q is not a directory", t.WorkDir()))
+			}
+		}
+	}
+	for _, cycle := range findCycles(g) {
+		problems = append(problems, Problem{
+			File:    cfg.Tasks[cycle[0]].file,
+			Message: "cycle detected: " + strings.Join(cycle, " -> "),
+		})
+	}
+	return problems
+}
+
+// asProblem keeps Problem values as they are and wraps any other error
+func asProblem(err error) Problem {
+	var p Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	return Problem{Message: err.Error()}
+}
+
+// checkTaskTemplates parses every templated field of task t and reports
+// parse errors and references to variables no scope defines
+func checkTaskTemplates(cfg *Config, name string, t *TaskConfig, cliVars map[string]string) []Problem {
+	known := map[string]bool{"CLI_ARGS": true, "USER_WORKING_DIR": true, "env": true, "deps": true}
+	for _, vars := range []map[string]Var{cfg.Vars, t.fileVars, t.Vars} {
+		for k := range vars {
+			known[k] = true
+		}
+	}
+	// vars passed by deps calling the task
+	for _, caller := range cfg.Tasks {
+		for _, d := range caller.Deps {
+			if d.Task == name {
+				for k := range d.Vars {
+					known[k] = true
+				}
+			}
+		}
+	}
+	for k := range cliVars {
+		known[k] = true
+	}
+	for _, a := range t.Args {
+		known[a.Name] = true
+	}
+
+	fields := taskTemplateFields(t)
+
+	pos := Problem{File: t.file, Task: name}
+	var problems []Problem
+	for _, f := range fields {
+		tpl, err := template.New(f.what).Parse(f.text)
+		if err != nil {
+			problems = append(problems, pos.withMessage("%s: bad template: %v", f.what, err))
+			continue
+		}
+		seen := map[string]bool{}
+		for _, v := range templateVars(tpl.Tree.Root) {
+			if known[v] || seen[v] {
+				continue
+			}
+			seen[v] = true
+			problems = append(problems, pos.withMessage("%s: undefined var %q%s", f.what, v, didYouMean(v, sortedKeys(known))))
+		}
+	}
+	return problems
+}
+
+// checkTemplatedNames renders templated deps and post names of task t with
+// --var values and arg defaults and reports names that are not tasks. Names
+// that need a var computed by sh are known only for a run.
+func checkTemplatedNames(cfg *Config, scope varScope, name string, t *TaskConfig) []Problem {
+	if !hasTemplatedNames(t) {
+		return nil
+	}
+	vars, err := scope.forFields(t, nil)
+	pos := Problem{File: t.file, Task: name}
+	if err != nil {
+		return []Problem{pos.withMessage("%v", err)}
+	}
+	unknown := scope.dynamicDefs(t)
+	names := cfg.TaskNames()
+
+	var problems []Problem
+	check := func(what, text string, emptyOK bool) {
+		if !strings.Contains(text, "{{") || refersToAny(unknown, text) {
+			return
+		}
+		rendered, err := renderTaskName(t, text, vars)
+		switch _, ok := cfg.Tasks[rendered]; {
+		case err != nil:
+			problems = append(problems, pos.withMessage("%s: %v", what, err))
+		case rendered == "" && !emptyOK:
+			problems = append(problems, pos.withMessage("%s: %q renders to an empty name", what, text))
+		case rendered != "" && !ok:
+			problems = append(problems, pos.withMessage("%s: %q renders to %q, which is not a task%s", what, text, rendered, didYouMean(rendered, names)))
+		}
+	}
+	for i, d := range t.Deps {
+		check(fmt.Sprintf("deps[%d]", i), d.Task, true)
+	}
+	for i, p := range t.Post {
+		check(fmt.Sprintf("post[%d]", i), p.Name, false)
+	}
+	return problems
+}
+
+// templateField — templated setting of a task, what names it in messages
+type templateField struct {
+	what, text string
+}
+
+// taskNameFields lists the settings of t that name other tasks: deps, vars
+// passed by deps and post names
+func taskNameFields(t *TaskConfig) []templateField {
+	var fields []templateField
+	for i, d := range t.Deps {
+		fields = append(fields, templateField{fmt.Sprintf("deps[%d]", i), d.Task})
+		varKeys := make([]string, 0, len(d.Vars))
+		for k := range d.Vars {
+			varKeys = append(varKeys, k)
+		}
+		sort.Strings(varKeys)
+		for _, k := range varKeys {
+			fields = append(fields, templateField{fmt.Sprintf("deps[%d].vars.%s", i, k), d.Vars[k]})
+		}
+	}
+	for i, p := range t.Post {
+		fields = append(fields, templateField{fmt.Sprintf("post[%d]", i), p.Name})
+	}
+	return fields
+}
+
+// taskTemplateFields lists every setting of t rendered with the task's vars
+func taskTemplateFields(t *TaskConfig) []templateField {
+	var fields []templateField
+	if t.Dir != "" {
+		fields = append(fields, templateField{"dir", t.Dir})
+	}
+	envKeys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	for _, k := range envKeys {
+		fields = append(fields, templateField{"env." + k, t.Env[k]})
+	}
+	fields = append(fields, taskNameFields(t)...)
+	for i, c := range t.Cmds {
+		fields = append(fields, templateField{fmt.Sprintf("cmds[%d]", i), c.Cmd})
+	}
+	if t.If != "" {
+		fields = append(fields, templateField{"if", t.If})
+	}
+	for i, p := range t.Preconditions {
+		fields = append(fields, templateField{fmt.Sprintf("preconditions[%d]", i), p.Sh})
+	}
+	for i, s := range t.Sources {
+		fields = append(fields, templateField{fmt.Sprintf("sources[%d]", i), s})
+	}
+	for i, s := range t.Generates {
+		fields = append(fields, templateField{fmt.Sprintf("generates[%d]", i), s})
+	}
+	for i, s := range t.Watch {
+		fields = append(fields, templateField{fmt.Sprintf("watch[%d]", i), s})
+	}
+	for _, name := range sortedOutputNames(t) {
+		o := t.Outputs[name]
+		fields = append(fields, templateField{"outputs." + name, o.Sh + o.File})
+	}
+	return fields
+}
+
+// templateVars returns names of the vars a template refers to as {{.NAME}}
+// or {{$.NAME}}. Bodies of range/with are skipped, dot is not the vars there.
+func templateVars(node parse.Node) []string {
+	var out []string
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			out = append(out, n.Ident[0])
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				out = append(out, n.Ident[1])
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(node)
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,241 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Var — value in `vars:`: a literal, or `{sh: ...}` whose trimmed stdout
+// becomes the value. The command runs only when a template of a running task
+// refers to the var, at most once per run.
+type Var struct {
+	Value string `yaml:"-" json:"value,omitempty"`
+	Sh    string `yaml:"sh" json:"sh,omitempty"`
+	dir   string // dir of the file that defined the var, sh runs there
+}
+
+func (v *Var) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&v.Value)
+	}
+	type rawVar Var
+	return node.Decode((*rawVar)(v))
+}
+
+// varScope resolves variables of a task: merged global vars, then vars of
+// the file the task comes from, then vars of the task itself, then defaults
+// of its args, then values given with --var, then vars passed by the dep
+// or the positional values of the command line call that called it.
+// Vars computed by sh are evaluated only with dyn set, by a run or
+// `show --resolved`; otherwise they are left out.
+type varScope struct {
+	global    map[string]string
+	dynamic   map[string]Var // global vars computed by sh
+	overrides map[string]string
+	dyn       *dynamicVars
+}
+
+func newVarScope(cfg *Config, overrides map[string]string) varScope {
+	dynamic := map[string]Var{}
+	for k, v := range cfg.Vars {
+		if v.Sh != "" {
+			dynamic[k] = v
+		}
+	}
+	return varScope{
+		global:    MergeVars(cfg, overrides),
+		dynamic:   dynamic,
+		overrides: overrides,
+	}
+}
+
+// forTask returns the vars of task t. Dynamic vars are evaluated only if
+// the task's templates refer to them.
+func (s varScope) forTask(t *TaskConfig) (map[string]string, error) {
+	return s.forFields(t, taskTemplateFields(t))
+}
+
+// forFields returns the vars of task t with the dynamic vars fields refer to
+func (s varScope) forFields(t *TaskConfig, fields []templateField) (map[string]string, error) {
+	vars := s.global
+	if len(t.fileVars) > 0 || len(t.Vars) > 0 || len(t.Args) > 0 || len(t.callVars) > 0 {
+		vars = make(map[string]string, len(s.global)+len(t.fileVars)+len(t.Vars)+len(t.Args))
+		for k, v := range s.global {
+			vars[k] = v
+		}
+		for _, layer := range []map[string]Var{t.fileVars, t.Vars} {
+			for k, v := range layer {
+				if v.Sh == "" {
+					vars[k] = v.Value
+				}
+			}
+		}
+		for _, a := range t.Args {
+			vars[a.Name] = a.Default
+		}
+		for _, layer := range []map[string]string{s.overrides, t.callVars} {
+			for k, v := range layer {
+				vars[k] = v
+			}
+		}
+	}
+
+	defs := s.dynamicDefs(t)
+	if len(defs) == 0 || s.dyn == nil {
+		return vars, nil
+	}
+	var texts []string
+	for _, f := range fields {
+		texts = append(texts, f.text)
+	}
+	return s.dyn.resolve(vars, defs, texts)
+}
+
+// dynamicDefs returns the vars of task t computed by sh, by name
+func (s varScope) dynamicDefs(t *TaskConfig) map[string]Var {
+	defs := map[string]Var{}
+	for k, v := range s.dynamic {
+		defs[k] = v
+	}
+	for _, layer := range []map[string]Var{t.fileVars, t.Vars} {
+		for k, v := range layer {
+			if v.Sh != "" {
+				defs[k] = v
+			} else {
+				delete(defs, k)
+			}
+		}
+	}
+	for _, a := range t.Args {
+		delete(defs, a.Name)
+	}
+	for _, layer := range []map[string]string{s.overrides, t.callVars} {
+		for k := range layer {
+			delete(defs, k)
+		}
+	}
+	return defs
+}
+
+// dynamicVars evaluates sh of dynamic vars and caches the values for the run
+type dynamicVars struct {
+	ctx   context.Context
+	grace time.Duration
+	mu    sync.Mutex
+	cache map[string]*dynamicValue // by dir and rendered command
+}
+
+type dynamicValue struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+func newDynamicVars(ctx context.Context, grace time.Duration) *dynamicVars {
+	return &dynamicVars{ctx: ctx, grace: grace, cache: map[string]*dynamicValue{}}
+}
+
+// resolve returns vars with the defs referred to by texts (or by the sh of
+// another needed def) evaluated; defs nobody refers to are left out
+func (d *dynamicVars) resolve(vars map[string]string, defs map[string]Var, texts []string) (map[string]string, error) {
+	out := make(map[string]string, len(vars)+len(defs))
+	for k, v := range vars {
+		if _, ok := defs[k]; !ok {
+			out[k] = v
+		}
+	}
+
+	done := map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		for i, p := range path {
+			if p == name {
+				return fmt.Errorf("var %s: cycle %s", name, strings.Join(append(path[i:], name), " -> "))
+			}
+		}
+		def := defs[name]
+		for _, ref := range templateRefs(def.Sh) {
+			if _, ok := defs[ref]; ok {
+				if err := visit(ref, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		cmdStr, err := renderTemplate(def.Sh, out)
+		if err != nil {
+			return fmt.Errorf("var %s: %w", name, err)
+		}
+		value, err := d.eval(def.dir, cmdStr)
+		if err != nil {
+			return fmt.Errorf("var %s: %w", name, err)
+		}
+		out[name] = value
+		done[name] = true
+		return nil
+	}
+
+	needed := map[string]bool{}
+	for _, text := range texts {
+		for _, ref := range templateRefs(text) {
+			if _, ok := defs[ref]; ok {
+				needed[ref] = true
+			}
+		}
+	}
+	for _, name := range sortedKeys(needed) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// eval runs cmdStr in dir once per run and returns its trimmed stdout
+func (d *dynamicVars) eval(dir, cmdStr string) (string, error) {
+	d.mu.Lock()
+	v, ok := d.cache[dir+"\x00"+cmdStr]
+	if !ok {
+		v = &dynamicValue{}
+		d.cache[dir+"\x00"+cmdStr] = v
+	}
+	d.mu.Unlock()
+
+	v.once.Do(func() {
+		var stdout bytes.Buffer
+		cmd := exec.Command("sh", "-c", cmdStr)
+		cmd.Dir = dir
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := runCommand(d.ctx, cmd, false, d.grace); err != nil {
+			v.err = fmt.Errorf("command %q failed: %w", cmdStr, err)
+			return
+		}
+		v.value = strings.TrimSpace(stdout.String())
+	})
+	return v.value, v.err
+}
+
+// templateRefs returns names of the vars text refers to; a broken template
+// refers to nothing, rendering it reports the error
+func templateRefs(text string) []string {
+	if !strings.Contains(text, "{{") {
+		return nil
+	}
+	tpl, err := template.New("").Parse(text)
+	if err != nil || tpl.Tree == nil {
+		return nil
+	}
+	return templateVars(tpl.Tree.Root)
+}
@@ -0,0 +1,74 @@
+package src
+
+import "testing"
+
+func TestVarPrecedence(t *testing.T) {
+	// every var is set by the layers up to the one named by its value,
+	// so the value tells which layer won
+	layers := []string{"global", "file", "task", "arg", "cli", "call"}
+	names := map[string]string{"global": "G", "file": "F", "task": "T", "arg": "A", "cli": "V", "call": "C"}
+	cfg := &Config{Vars: map[string]Var{}}
+	task := &TaskConfig{fileVars: map[string]Var{}, Vars: map[string]Var{}, callVars: map[string]string{}}
+	overrides := map[string]string{}
+	for i, layer := range layers {
+		for _, winner := range layers[i:] {
+			name := names[winner]
+			switch layer {
+			case "global":
+				cfg.Vars[name] = Var{Value: layer}
+			case "file":
+				task.fileVars[name] = Var{Value: layer}
+			case "task":
+				task.Vars[name] = Var{Value: layer}
+			case "arg":
+				task.Args = append(task.Args, TaskArg{Name: name, Default: layer})
+			case "cli":
+				overrides[name] = layer
+			case "call":
+				task.callVars[name] = layer
+			}
+		}
+	}
+	vars, err := newVarScope(cfg, overrides).forTask(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"global var", "G", "global"},
+		{"file vars beat global ones", "F", "file"},
+		{"task vars beat file vars", "T", "task"},
+		{"arg defaults beat task vars", "A", "arg"},
+		{"--var beats arg defaults", "V", "cli"},
+		{"call vars beat --var", "C", "call"},
+	}
+	for _, tt := range tests {
+		if got := vars[tt.key]; got != tt.want {
+			t.Errorf("%s: %s = %q, want %q", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDynamicDefs(t *testing.T) {
+	cfg := &Config{Vars: map[string]Var{
+		"SHA":  {Sh: "git rev-parse HEAD"},
+		"DATE": {Sh: "date"},
+		"NAME": {Sh: "whoami"},
+		"TAG":  {Sh: "git describe"},
+	}}
+	task := &TaskConfig{
+		Vars:     map[string]Var{"DATE": {Value: "today"}, "HOST": {Sh: "hostname"}},
+		Args:     []TaskArg{{Name: "NAME"}},
+		callVars: map[string]string{"TAG": "v1"},
+	}
+	defs := newVarScope(cfg, map[string]string{}).dynamicDefs(task)
+	for name, want := range map[string]bool{"SHA": true, "HOST": true, "DATE": false, "NAME": false, "TAG": false} {
+		if _, got := defs[name]; got != want {
+			t.Errorf("%s computed by sh: %v, want %v", name, got, want)
+		}
+	}
+}
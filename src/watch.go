@@ -0,0 +1,340 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errRestart is the cancellation cause of a run restarted by `--watch`
+var errRestart = errors.New("restarted after a change")
+
+// pollInterval — how often files are checked when inotify is not available
+const pollInterval = 500 * time.Millisecond
+
+// fileNotifier wakes the watch loop when something in the watched
+// directories may have changed; the loop then compares snapshots
+type fileNotifier interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// watchGroup — rendered globs of one task, relative to its dir
+type watchGroup struct {
+	dir       string
+	patterns  []string // sources and watch
+	generates []string // never trigger a restart
+}
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// WatchTasks runs calls and runs them again whenever a file matching
+// sources or watch of any task of the run changes. A run still in progress
+// is cancelled before the restart. Returns on SIGINT/SIGTERM.
+func WatchTasks(cfg *Config, calls []TaskCall, opts RunOptions, debounce time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watchTasksContext(ctx, cfg, calls, opts, debounce)
+}
+
+// watchTasksContext is WatchTasks returning when ctx is done
+func watchTasksContext(ctx context.Context, cfg *Config, calls []TaskCall, opts RunOptions, debounce time.Duration) error {
+	plan, err := newRunPlan(ctx, cfg, calls, opts)
+	if err != nil {
+		return err
+	}
+	groups, err := newWatchGroups(plan)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return fmt.Errorf("nothing to watch: no task of %s has sources or watch", strings.Join(plan.roots, ", "))
+	}
+	if opts.Format == formatJSON {
+		// the event log of every run writes to stdout, watch events go there too
+		opts.events = newEventLog(os.Stdout)
+	}
+
+	notifier, err := newNotifier(watchDirs(groups))
+	if err != nil {
+		if opts.Verbose {
+			opts.printf("inotify is not available (%v), polling every %s\n", err, pollInterval)
+		}
+		notifier = newPollNotifier(pollInterval)
+	}
+	defer notifier.Close()
+
+	files, err := snapshotFiles(groups)
+	if err != nil {
+		return err
+	}
+	for {
+		runCtx, cancelRun := context.WithCancelCause(ctx)
+		done := make(chan error, 1)
+		go func() {
+			runOpts := opts
+			runOpts.events = nil
+			done <- runTasksContext(runCtx, cfg, calls, runOpts)
+		}()
+		running := true
+
+		var changed []string
+		var settle <-chan time.Time // fires once a burst of changes is over
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				cancelRun(nil)
+				if running {
+					<-done
+				}
+				return nil
+			case err := <-done:
+				running = false
+				if err != nil && opts.events == nil {
+					fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+				}
+				opts.printf("👀 watching %d files for changes (Ctrl+C to stop)\n", len(files))
+			case <-notifier.Events():
+				current, err := snapshotFiles(groups)
+				if err != nil {
+					cancelRun(nil)
+					return err
+				}
+				if diff := changedFiles(files, current); len(diff) > 0 {
+					changed = append(changed, diff...)
+					settle = time.After(debounce)
+				}
+				files = current
+			case <-settle:
+				break wait
+			}
+		}
+
+		if running {
+			cancelRun(errRestart)
+			<-done
+		}
+		cancelRun(nil)
+		changed = uniqueSorted(changed)
+		for i, f := range changed {
+			changed[i] = relToCwd(f)
+		}
+		opts.emit(Event{Type: "watch_change", Files: changed})
+		opts.printf("↻ changed: %s, restarting\n", strings.Join(changed, ", "))
+	}
+}
+
+// newWatchGroups renders sources, watch and generates of every task of the plan
+func newWatchGroups(plan *runPlan) ([]watchGroup, error) {
+	var groups []watchGroup
+	for _, name := range plan.subgraph {
+		t := plan.g.Nodes[name].Cfg
+		if len(t.Sources) == 0 && len(t.Watch) == 0 {
+			continue
+		}
+		vars, err := plan.scope.forTask(t)
+		if err != nil {
+			return nil, fmt.Errorf("task %q: %w", name, err)
+		}
+		// dir is rendered without outputs of deps, these are known only in a run
+		rt, err := renderTaskEnv(t, vars)
+		if err != nil {
+			return nil, fmt.Errorf("task %q: %w", name, err)
+		}
+		wg := watchGroup{dir: rt.WorkDir()}
+		for _, list := range []StringSlice{t.Sources, t.Watch} {
+			for _, p := range list {
+				rendered, err := renderTemplate(p, vars)
+				if err != nil {
+					return nil, fmt.Errorf("task %q: %w", name, err)
+				}
+				wg.patterns = append(wg.patterns, rendered)
+			}
+		}
+		for _, p := range t.Generates {
+			rendered, err := renderTemplate(p, vars)
+			if err != nil {
+				return nil, fmt.Errorf("task %q: %w", name, err)
+			}
+			wg.generates = append(wg.generates, rendered)
+		}
+		groups = append(groups, wg)
+	}
+	return groups, nil
+}
+
+// snapshotFiles returns mtime and size of every watched file. Generated
+// files and anything inside .git or .wrkit are left out.
+func snapshotFiles(groups []watchGroup) (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	for _, wg := range groups {
+		matches, err := globFiles(wg.dir, wg.patterns)
+		if err != nil {
+			return nil, err
+		}
+		generated, err := globFiles(wg.dir, wg.generates)
+		if err != nil {
+			return nil, err
+		}
+		skip := map[string]bool{}
+		for _, f := range generated {
+			skip[f] = true
+		}
+		for _, f := range matches {
+			if skip[f] || inSkippedDir(f) {
+				continue
+			}
+			fi, err := os.Stat(f)
+			if err != nil {
+				continue // removed in the meantime
+			}
+			files[f] = fileStamp{mod: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return files, nil
+}
+
+func inSkippedDir(path string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(path), "/") {
+		if skipDirs[seg] {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles lists files added, removed or modified between two snapshots
+func changedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+	for f, st := range after {
+		if old, ok := before[f]; !ok || !old.mod.Equal(st.mod) || old.size != st.size {
+			changed = append(changed, f)
+		}
+	}
+	for f := range before {
+		if _, ok := after[f]; !ok {
+			changed = append(changed, f)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func uniqueSorted(list []string) []string {
+	seen := map[string]bool{}
+	for _, s := range list {
+		seen[s] = true
+	}
+	return sortedKeys(seen)
+}
+
+// relToCwd shortens path to one relative to the current directory, if it is inside it
+func relToCwd(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// watchDirs returns directories whose entries can match the patterns: the
+// part of a pattern before the first wildcard directory, recursively when
+// the wildcard is not in the file name. A missing directory is replaced by
+// its closest existing parent, its creation is noticed there.
+func watchDirs(groups []watchGroup) []string {
+	dirs := map[string]bool{}
+	for _, wg := range groups {
+		for _, p := range wg.patterns {
+			p = filepath.ToSlash(p)
+			dir := wg.dir
+			if filepath.IsAbs(p) {
+				dir = ""
+			}
+			segs := strings.Split(p, "/")
+			i := 0
+			for i < len(segs)-1 && !hasMeta(segs[i]) {
+				i++
+			}
+			root := filepath.Join(dir, filepath.FromSlash(strings.Join(segs[:i], "/")))
+			if root == "" {
+				root = "."
+			}
+			recursive := i < len(segs)-1
+			for {
+				if fi, err := os.Stat(root); err == nil && fi.IsDir() {
+					break
+				}
+				parent := filepath.Dir(root)
+				if parent == root {
+					break
+				}
+				root, recursive = parent, false
+			}
+			if !recursive {
+				dirs[root] = true
+				continue
+			}
+			_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || !d.IsDir() {
+					return nil
+				}
+				if path != root && skipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				dirs[path] = true
+				return nil
+			})
+		}
+	}
+	return sortedKeys(dirs)
+}
+
+// pollNotifier wakes the watch loop every interval
+type pollNotifier struct {
+	events chan struct{}
+	done   chan struct{}
+}
+
+func newPollNotifier(interval time.Duration) *pollNotifier {
+	n := &pollNotifier{events: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case n.events <- struct{}{}:
+				case <-n.done:
+					return
+				}
+			case <-n.done:
+				return
+			}
+		}
+	}()
+	return n
+}
+
+func (n *pollNotifier) Events() <-chan struct{} { return n.events }
+
+func (n *pollNotifier) Close() error {
+	close(n.done)
+	return nil
+}
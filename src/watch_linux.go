@@ -0,0 +1,112 @@
+//go:build linux
+
+package src
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_ONLYDIR
+
+// inotifyNotifier watches directories with inotify. Directories created
+// inside watched ones are watched too, so new files there are noticed.
+type inotifyNotifier struct {
+	fd     int
+	f      *os.File // non-blocking fd in the runtime poller: Close interrupts Read
+	events chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int32]string
+}
+
+func newNotifier(dirs []string) (fileNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	n := &inotifyNotifier{
+		fd:     fd,
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+		dirs:   map[int32]string{},
+	}
+	for _, d := range dirs {
+		if err := n.add(d); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		if err == syscall.ENOENT || err == syscall.ENOTDIR {
+			return nil // gone already
+		}
+		// ENOSPC: fs.inotify.max_user_watches is too low for the tree
+		return os.NewSyscallError("inotify_add_watch "+dir, err)
+	}
+	n.mu.Lock()
+	n.dirs[int32(wd)] = dir
+	n.mu.Unlock()
+	return nil
+}
+
+// addTree watches a new directory and everything below it
+func (n *inotifyNotifier) addTree(root string) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if skipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		_ = n.add(path)
+		return nil
+	})
+}
+
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		k, err := n.f.Read(buf)
+		if err != nil {
+			return // closed
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= k; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + syscall.SizeofInotifyEvent
+			off = nameStart + int(ev.Len)
+			if ev.Mask&syscall.IN_ISDIR == 0 || ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 {
+				continue
+			}
+			n.mu.Lock()
+			dir, ok := n.dirs[ev.Wd]
+			n.mu.Unlock()
+			if ok {
+				name := strings.TrimRight(string(buf[nameStart:off]), "\x00")
+				n.addTree(filepath.Join(dir, name))
+			}
+		}
+		select {
+		case n.events <- struct{}{}:
+		default: // the loop has not picked up the previous wake-up yet
+		}
+	}
+}
+
+func (n *inotifyNotifier) Events() <-chan struct{} { return n.events }
+
+func (n *inotifyNotifier) Close() error {
+	return n.f.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package src
+
+import "errors"
+
+// newNotifier is only implemented with inotify, elsewhere `--watch` polls
+func newNotifier(dirs []string) (fileNotifier, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
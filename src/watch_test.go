@@ -0,0 +1,88 @@
+package src
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processAlive reports whether pid runs; zombies of killed orphans do not count
+func processAlive(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	return err == nil && !strings.HasPrefix(strings.TrimSpace(string(out)), "Z")
+}
+
+// waitForPids waits until the file lists n pids
+func waitForPids(t *testing.T, path string, n int) []int {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(path)
+		if lines := strings.Fields(string(data)); len(lines) >= n {
+			var pids []int
+			for _, l := range lines {
+				pid, err := strconv.Atoi(l)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pids = append(pids, pid)
+			}
+			return pids
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s: %d pids did not show up", path, n)
+	return nil
+}
+
+// A restart kills the whole process group of the cancelled run,
+// background children of sequential tasks included.
+func TestWatchRestartKillsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh and process groups")
+	}
+	dir := t.TempDir()
+	config := "tasks:\n  serve:\n    sources: [src.txt]\n    cmds:\n      - sleep 300 & echo $! >> pids; wait\n"
+	if err := os.WriteFile(filepath.Join(dir, "wrkit.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "src.txt")
+	if err := os.WriteFile(src, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(filepath.Join(dir, "wrkit.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		opts := RunOptions{Concurrency: 1, GracePeriod: time.Second}
+		done <- watchTasksContext(ctx, cfg, []TaskCall{{Name: "serve"}}, opts, 10*time.Millisecond)
+	}()
+
+	pidFile := filepath.Join(dir, "pids")
+	waitForPids(t, pidFile, 1)
+	if err := os.WriteFile(src, []byte("22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pids := waitForPids(t, pidFile, 2)
+	if processAlive(pids[0]) {
+		t.Errorf("child %d of the first run survived the restart", pids[0])
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("watch: %v", err)
+	}
+	if processAlive(pids[1]) {
+		t.Errorf("child %d of the last run survived the stop", pids[1])
+	}
+}
@@ -1,36 +1,339 @@
 package src
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config описывает структуру wrkit.yaml
 type Config struct {
-	Vars  map[string]string      `yaml:"vars,omitempty"`
-	Tasks map[string]*TaskConfig `yaml:"tasks"`
+	Vars     map[string]Var           `yaml:"vars,omitempty"`
+	Includes map[string]IncludeConfig `yaml:"includes,omitempty"`
+	Output   *OutputConfig            `yaml:"output,omitempty"` // default for tasks of this file
+	Tasks    map[string]*TaskConfig   `yaml:"tasks,omitempty"`
+
+	path     string  // local file the config was loaded from, empty if none
+	problems []error // non-fatal load errors (unknown keys, unknown post-tasks), see Problem
+}
+
+// configFileNames are looked up, in this order, when --file is not set
+var configFileNames = []string{"wrkit.yaml", "wrkit.yml", ".wrkit.yaml"}
+
+// FindConfig searches dir and its parents for a wrkit file. The search stops
+// at the repository root (a directory containing .git) or the filesystem
+// root. Returns "" if nothing is found.
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range configFileNames {
+			p := filepath.Join(dir, name)
+			if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+				return p, nil
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// StateRoot returns the directory for the .wrkit state: next to the local file, or the current directory
+func (c *Config) StateRoot() string {
+	if c.path == "" {
+		return ""
+	}
+	return filepath.Dir(c.path)
 }
 
 // PostTaskConfig — описание post-task'а
 type PostTaskConfig struct {
 	Name string `yaml:"name"`
-	When string `yaml:"when,omitempty"` // always, success, fails
+	When string `yaml:"when,omitempty" enum:"success,fail,fails,failed,always"`
+
+	line, column int // position in the config file, for error messages
+}
+
+func (p *PostTaskConfig) UnmarshalYAML(node *yaml.Node) error {
+	type rawPostTask PostTaskConfig
+	if err := node.Decode((*rawPostTask)(p)); err != nil {
+		return err
+	}
+	p.line, p.column = node.Line, node.Column
+	return nil
+}
+
+// TaskDep — dep of a task: a task name, or `{task: ..., vars: ...}` to run
+// the task with these vars (values are templates rendered with the caller's
+// vars). Calls with different vars are different tasks of the graph.
+type TaskDep struct {
+	Task string            `yaml:"task"`
+	Vars map[string]string `yaml:"vars,omitempty"`
+}
+
+func (d *TaskDep) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&d.Task)
+	}
+	type rawTaskDep TaskDep
+	return node.Decode((*rawTaskDep)(d))
+}
+
+// String returns the name of the graph node the dep refers to
+func (d TaskDep) String() string {
+	return instanceName(d.Task, d.Vars)
+}
+
+// depNames returns the names of deps, as shown by list and show
+func depNames(deps []TaskDep) []string {
+	if deps == nil {
+		return nil
+	}
+	names := make([]string, len(deps))
+	for i, d := range deps {
+		names[i] = d.String()
+	}
+	return names
 }
 
 // TaskConfig — описание одной задачи
 type TaskConfig struct {
 	Desc     string            `yaml:"desc,omitempty"`
-	Cmds     StringSlice       `yaml:"cmds"`
-	Deps     []string          `yaml:"deps,omitempty"`
+	Cmds     Commands          `yaml:"cmds,omitempty"`
+	Deps     []TaskDep         `yaml:"deps,omitempty"`
 	Dir      string            `yaml:"dir,omitempty"`
 	Env      map[string]string `yaml:"env,omitempty"`
 	Parallel bool              `yaml:"parallel,omitempty"`
-	Post     []PostTaskConfig  `yaml:"post,omitempty"` // Новое поле
+	Post     []PostTaskConfig  `yaml:"post,omitempty"`    // Новое поле
+	Timeout  time.Duration     `yaml:"timeout,omitempty"` // default limit for each command
+	Retry    *RetryConfig      `yaml:"retry,omitempty"`
+
+	// Up-to-date check: task is skipped when sources did not change since the
+	// last successful run and every generated file exists
+	Sources   StringSlice `yaml:"sources,omitempty"`
+	Generates StringSlice `yaml:"generates,omitempty"`
+	Method    string      `yaml:"method,omitempty" enum:"checksum,timestamp"` // checksum (default)
+
+	// Extra globs that restart `--watch`, besides sources
+	Watch StringSlice `yaml:"watch,omitempty"`
+
+	// Conditions checked before cmds: a false `if` skips the task quietly,
+	// a failed precondition aborts or skips it depending on its on_fail
+	If            string         `yaml:"if,omitempty"`
+	Preconditions []Precondition `yaml:"preconditions,omitempty"`
+
+	// Named positional arguments: `wrkit task v1 v2` sets them as variables
+	Args []TaskArg `yaml:"args,omitempty"`
+
+	Tags []string `yaml:"tags,omitempty"` // free-form labels for `list --tag`
+
+	Output *OutputConfig `yaml:"output,omitempty"` // interleaved (default), prefixed, grouped
+
+	// Values captured after cmds succeed, for dependents as {{.deps.TASK.NAME}}
+	Outputs map[string]OutputVar `yaml:"outputs,omitempty"`
+
+	// Vars of this task only: override global and file vars, --var still wins
+	Vars map[string]Var `yaml:"vars,omitempty"`
+
+	// Set while loading: file that defined the task, its default dir and vars,
+	// and whether it came from the local file or the master one
+	file     string
+	baseDir  string
+	fileVars map[string]Var
+	origin   string
+
+	// scopeName maps a rendered dep or post name of an included task to the
+	// full name, as done for plain names at load time; nil for local tasks
+	scopeName func(string) string
+
+	// Set for a task called by a dep with vars: the task it was made from and
+	// the vars of the call, which win over any other
+	instanceOf string
+	callVars   map[string]string
+}
+
+// Task origins
+const (
+	originLocal  = "local"
+	originMaster = "master"
+)
+
+// WorkDir returns the directory the task's commands run in; empty means the current directory.
+// Relative dir is resolved against the directory of the file that defined the task.
+func (t *TaskConfig) WorkDir() string {
+	if t.Dir == "" {
+		return t.baseDir
+	}
+	if filepath.IsAbs(t.Dir) || t.baseDir == "" {
+		return t.Dir
+	}
+	return filepath.Join(t.baseDir, t.Dir)
+}
+
+// TaskArg — named positional argument of a task
+type TaskArg struct {
+	Name     string `yaml:"name" json:"name"`
+	Desc     string `yaml:"desc,omitempty" json:"desc,omitempty"`
+	Default  string `yaml:"default,omitempty" json:"default,omitempty"`
+	Required bool   `yaml:"required,omitempty" json:"required,omitempty"`
+}
+
+// Precondition — shell snippet (templates allowed) that must succeed before
+// the task runs. In YAML it is either a plain string or a mapping.
+type Precondition struct {
+	Sh     string `yaml:"sh" json:"sh"`
+	Msg    string `yaml:"msg,omitempty" json:"msg,omitempty"`
+	OnFail string `yaml:"on_fail,omitempty" json:"on_fail,omitempty" enum:"fail,skip"` // fail (default)
+}
+
+func (p *Precondition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&p.Sh)
+	}
+	type rawPrecondition Precondition
+	return node.Decode((*rawPrecondition)(p))
+}
+
+// Validate checks enum values of the task settings
+func (t *TaskConfig) Validate() error {
+	switch t.Method {
+	case "", "checksum", "timestamp":
+	default:
+		return fmt.Errorf("unknown method %q (expected checksum or timestamp)", t.Method)
+	}
+	seenArgs := map[string]bool{}
+	for _, a := range t.Args {
+		if a.Name == "" {
+			return fmt.Errorf("arg without name")
+		}
+		if seenArgs[a.Name] {
+			return fmt.Errorf("duplicate arg %q", a.Name)
+		}
+		seenArgs[a.Name] = true
+	}
+	for _, p := range t.Preconditions {
+		if strings.TrimSpace(p.Sh) == "" {
+			return fmt.Errorf("precondition has empty sh")
+		}
+		switch p.OnFail {
+		case "", "fail", "skip":
+		default:
+			return fmt.Errorf("unknown precondition on_fail %q (expected fail or skip)", p.OnFail)
+		}
+	}
+	if t.Output != nil {
+		if err := t.Output.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedOutputNames(t) {
+		o := t.Outputs[name]
+		if err := o.Validate(name); err != nil {
+			return err
+		}
+	}
+	if t.Retry != nil {
+		return t.Retry.Validate()
+	}
+	return nil
+}
+
+// RetryConfig — retry policy for flaky tasks
+type RetryConfig struct {
+	Attempts  int           `yaml:"attempts"`                                   // total number of runs, including the first one
+	Delay     time.Duration `yaml:"delay,omitempty"`                            // delay before the second attempt
+	Backoff   string        `yaml:"backoff,omitempty" enum:"fixed,exponential"` // fixed (default)
+	MaxDelay  time.Duration `yaml:"max_delay,omitempty"`                        // cap for exponential backoff
+	ExitCodes []int         `yaml:"exit_codes,omitempty"`                       // retry only these exit codes; empty — any failure
+	Scope     string        `yaml:"scope,omitempty" enum:"task,command"`        // task (default) re-runs all cmds, command — only the failing one
+}
+
+// Validate checks enum values of the retry policy
+func (r *RetryConfig) Validate() error {
+	switch r.Backoff {
+	case "", "fixed", "exponential":
+	default:
+		return fmt.Errorf("unknown retry backoff %q (expected fixed or exponential)", r.Backoff)
+	}
+	switch r.Scope {
+	case "", "task", "command":
+	default:
+		return fmt.Errorf("unknown retry scope %q (expected task or command)", r.Scope)
+	}
+	if r.Attempts < 0 || r.Delay < 0 || r.MaxDelay < 0 {
+		return fmt.Errorf("retry attempts and delays must not be negative")
+	}
+	return nil
+}
+
+// Command — one shell command of a task.
+// In YAML it is either a plain string or a mapping with options.
+type Command struct {
+	Cmd     string        `yaml:"cmd"`
+	Timeout time.Duration `yaml:"timeout,omitempty"` // overrides task timeout
+}
+
+// Commands supports YAML block scalar (one command per line) or a sequence
+// of strings and Command mappings
+type Commands []Command
+
+func (c *Commands) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		var lines StringSlice
+		if err := node.Decode(&lines); err != nil {
+			return err
+		}
+		*c = commandsFromStrings(lines)
+		return nil
+	}
+	out := make(Commands, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			var line string
+			if err := item.Decode(&line); err != nil {
+				return fmt.Errorf("decode cmds item: %w", err)
+			}
+			out = append(out, commandsFromStrings(normalizeLines([]string{line}))...)
+			continue
+		}
+		// plain alias type — avoids recursion into UnmarshalYAML
+		type rawCommand Command
+		var cmd rawCommand
+		if err := item.Decode(&cmd); err != nil {
+			return fmt.Errorf("decode cmds item: %w", err)
+		}
+		cmd.Cmd = strings.TrimSpace(cmd.Cmd)
+		if cmd.Cmd == "" {
+			return fmt.Errorf("line %d: cmds item has empty cmd", item.Line)
+		}
+		out = append(out, Command(cmd))
+	}
+	*c = out
+	return nil
+}
+
+func commandsFromStrings(lines []string) Commands {
+	out := make(Commands, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, Command{Cmd: l})
+	}
+	return out
 }
 
 // StringSlice supports YAML sequence or block scalar
@@ -77,8 +380,33 @@ func splitAndClean(raw string) []string {
 	return strings.Split(raw, "\n")
 }
 
-// LoadConfig reads YAML config, returns (nil, nil) if file does not exists
+// LoadConfig reads YAML config with its includes, returns (nil, nil) if file does not exists.
+// Tasks run relative to the directory of the file.
 func LoadConfig(path string) (*Config, error) {
+	cfg, err := loadRootConfig(path, filepath.Dir(path))
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	if err := errors.Join(cfg.problems...); err != nil {
+		return nil, err
+	}
+	cfg.path = path
+	return cfg, nil
+}
+
+// loadRootConfig reads a top-level config; its own tasks run in baseDir ("" — current directory)
+func loadRootConfig(path, baseDir string) (*Config, error) {
+	cfg, err := loadConfigFile(path, baseDir, nil)
+	if err != nil || cfg == nil {
+		return cfg, err
+	}
+	resolveRootNames(cfg)
+	return cfg, nil
+}
+
+// loadConfigFile reads one YAML file and its includes; stack holds the files
+// including this one and is used to detect include cycles
+func loadConfigFile(path, baseDir string, stack []string) (*Config, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -87,25 +415,57 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("read config %s: %w", path, err)
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(b, &cfg); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
 		return nil, fmt.Errorf("parse yaml %s: %w", path, err)
 	}
+	var cfg Config
+	if len(root.Content) > 0 {
+		if err := root.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("parse yaml %s: %w", path, err)
+		}
+	}
+	cfg.problems = unknownFields(path, &root, reflect.TypeOf(Config{}))
 	if cfg.Tasks == nil {
 		cfg.Tasks = map[string]*TaskConfig{}
 	}
 	if cfg.Vars == nil {
-		cfg.Vars = map[string]string{}
+		cfg.Vars = map[string]Var{}
+	}
+	for k, v := range cfg.Vars {
+		v.dir = baseDir
+		cfg.Vars[k] = v
+	}
+	for name, t := range cfg.Tasks {
+		if t == nil {
+			t = &TaskConfig{}
+			cfg.Tasks[name] = t
+		}
+		t.file = path
+		t.baseDir = baseDir
+		for k, v := range t.Vars {
+			v.dir = baseDir
+			t.Vars[k] = v
+		}
+		if t.Output == nil {
+			t.Output = cfg.Output
+		}
+	}
+	if err := loadIncludes(&cfg, path, stack); err != nil {
+		return nil, err
 	}
 	return &cfg, nil
 }
 
-// MergeVars merging variables from config, environment and CLI
+// MergeVars merging variables from config, environment and CLI.
+// Vars computed by sh are left out, varScope evaluates them when needed.
 func MergeVars(cfg *Config, cliVars map[string]string) map[string]string {
 	merged := make(map[string]string)
 
 	for k, v := range cfg.Vars {
-		merged[k] = v
+		if v.Sh == "" {
+			merged[k] = v.Value
+		}
 	}
 
 	envMap := map[string]string{}
@@ -120,6 +480,11 @@ func MergeVars(cfg *Config, cliVars map[string]string) map[string]string {
 		merged["env."+k] = v // adding with prefix
 	}
 
+	// directory wrkit was invoked from; tasks themselves run next to their file
+	if wd, err := os.Getwd(); err == nil {
+		merged["USER_WORKING_DIR"] = wd
+	}
+
 	for k, v := range cliVars {
 		merged[k] = v
 	}
@@ -127,15 +492,64 @@ func MergeVars(cfg *Config, cliVars map[string]string) map[string]string {
 	return merged
 }
 
-// LoadCombinedConfig searches for local wrkit.yaml and global ~/.wrkit.master.yaml
+// BindTaskArgs returns positional values of task t by the names of its
+// declared args. Args without a positional value fall back to --var, then to
+// their defaults (see varScope); a required one missing in both is an error.
+func BindTaskArgs(name string, t *TaskConfig, positional []string, cliVars map[string]string) (map[string]string, error) {
+	if len(positional) > len(t.Args) {
+		return nil, fmt.Errorf("task %q takes %d argument(s), got %d: %s", name, len(t.Args), len(positional), strings.Join(positional, " "))
+	}
+	vars := make(map[string]string, len(positional))
+	for i, a := range t.Args {
+		if i < len(positional) {
+			vars[a.Name] = positional[i]
+			continue
+		}
+		if _, ok := cliVars[a.Name]; !ok && a.Required {
+			return nil, fmt.Errorf("task %q: missing required argument %q", name, a.Name)
+		}
+	}
+	return vars, nil
+}
+
+// LoadCombinedConfig loads local config and global ~/.wrkit.master.yaml.
+// Empty localPath means searching wrkit.yaml upwards from the current directory (see FindConfig).
 // if noMaster == true, using only local file
 func LoadCombinedConfig(localPath string, noMaster bool) (*Config, error) {
+	cfg, err := loadCombinedConfig(localPath, noMaster)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(cfg.problems...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadCombinedConfig is LoadCombinedConfig that keeps non-fatal problems in Config.problems
+func loadCombinedConfig(localPath string, noMaster bool) (*Config, error) {
 	var masterCfg *Config
 	var err error
 
-	localCfg, err := LoadConfig(localPath)
-	if err != nil {
-		return nil, err
+	explicit := localPath != ""
+	if !explicit {
+		if localPath, err = FindConfig("."); err != nil {
+			return nil, err
+		}
+	}
+	var localCfg *Config
+	if localPath != "" {
+		localCfg, err = loadRootConfig(localPath, filepath.Dir(localPath))
+		if err != nil {
+			return nil, err
+		}
+		if localCfg == nil && explicit {
+			return nil, fmt.Errorf("config file %s not found", localPath)
+		}
+		if localCfg != nil {
+			localCfg.path = localPath
+			setOrigin(localCfg, originLocal)
+		}
 	}
 
 	if !noMaster {
@@ -145,27 +559,48 @@ func LoadCombinedConfig(localPath string, noMaster bool) (*Config, error) {
 		}
 		masterPath := filepath.Join(homeDir, ".wrkit.master.yaml")
 
-		masterCfg, err = LoadConfig(masterPath)
+		// global tasks run in the current directory
+		masterCfg, err = loadRootConfig(masterPath, "")
 		if err != nil {
 			return nil, err
 		}
+		setOrigin(masterCfg, originMaster)
+	}
+
+	cfg := mergeConfigs(masterCfg, localCfg)
+	cfg.problems = append(cfg.problems, checkPostTasks(cfg)...)
+	return cfg, nil
+}
+
+// setOrigin marks every task of cfg (nil is allowed) as coming from origin
+func setOrigin(cfg *Config, origin string) {
+	if cfg == nil {
+		return
 	}
+	for _, t := range cfg.Tasks {
+		t.origin = origin
+	}
+}
 
+// mergeConfigs merges master and local configs, any of them may be nil
+func mergeConfigs(masterCfg, localCfg *Config) *Config {
 	// if no any file — returning empty config
 	if localCfg == nil && masterCfg == nil {
-		return &Config{Vars: map[string]string{}, Tasks: map[string]*TaskConfig{}}, nil
+		return &Config{Vars: map[string]Var{}, Tasks: map[string]*TaskConfig{}}
 	}
 	if localCfg == nil {
-		return masterCfg, nil
+		return masterCfg
 	}
-	if masterCfg == nil || noMaster {
-		return localCfg, nil
+	if masterCfg == nil {
+		return localCfg
 	}
 
 	// Merging: local one is prioritized
 	merged := &Config{
-		Vars:  map[string]string{},
-		Tasks: map[string]*TaskConfig{},
+		Vars:     map[string]Var{},
+		Tasks:    map[string]*TaskConfig{},
+		path:     localCfg.path,
+		problems: append(append([]error(nil), masterCfg.problems...), localCfg.problems...),
 	}
 
 	for k, v := range masterCfg.Vars {
@@ -182,5 +617,39 @@ func LoadCombinedConfig(localPath string, noMaster bool) (*Config, error) {
 		merged.Tasks[k] = t
 	}
 
-	return merged, nil
+	return merged
+}
+
+// checkPostTasks reports post-tasks that refer to unknown tasks or have an unknown `when`
+func checkPostTasks(cfg *Config) []error {
+	names := cfg.TaskNames()
+	var errs []error
+	for _, name := range names {
+		t := cfg.Tasks[name]
+		for _, p := range t.Post {
+			pos := Problem{File: t.file, Line: p.line, Column: p.column, Task: name}
+			if _, ok := cfg.Tasks[p.Name]; !ok && !strings.Contains(p.Name, "{{") {
+				errs = append(errs, pos.withMessage("post-task %q is not a task%s", p.Name, didYouMean(p.Name, names)))
+			}
+			switch normalizeWhen(p.When) {
+			case "success", "fail", "always":
+			default:
+				errs = append(errs, pos.withMessage("post-task %q has unknown when %q (expected success, fail or always)", p.Name, p.When))
+			}
+		}
+	}
+	return errs
+}
+
+// TaskNames returns task names in sorted order
+func (c *Config) TaskNames() []string {
+	names := make([]string, 0, len(c.Tasks))
+	for name, t := range c.Tasks {
+		if t.instanceOf != "" {
+			continue // made from a dep with vars, not defined in a file
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }